@@ -0,0 +1,141 @@
+// Package codecs provides the ready-made session.Codecs. The messages
+// encoded are pooled, and their buffers are returned to pool once released
+// by session.
+package codecs
+
+import (
+	"encoding/binary"
+	"github.com/Godyy/go-net/session"
+	"reflect"
+	"sync"
+)
+
+// codecs codes the messages of single type with Marshaler.
+type codecs struct {
+	m        Marshaler
+	newValue func() interface{}
+}
+
+// New returns the Codecs of messages of single type in format of m. The
+// messages received are decoded into the pointer returned by newValue.
+func New(m Marshaler, newValue func() interface{}) session.Codecs {
+	if newValue == nil {
+		panic(ErrNilValue)
+	}
+	return &codecs{m: m, newValue: newValue}
+}
+
+// NewJSON returns the Codecs of messages of single type in JSON.
+func NewJSON(newValue func() interface{}) session.Codecs { return New(JSON, newValue) }
+
+// NewGob returns the Codecs of messages of single type in gob.
+func NewGob(newValue func() interface{}) session.Codecs { return New(Gob, newValue) }
+
+// NewProto returns the Codecs of messages of single type in protobuf.
+func NewProto(newValue func() interface{}) session.Codecs { return New(Proto, newValue) }
+
+func (c *codecs) Encode(o interface{}) (session.Message, error) {
+	buf := getBuffer()
+	if err := c.m.Marshal(buf, o); err != nil {
+		putBuffer(buf)
+		return nil, err
+	}
+	return &message{buf: buf}, nil
+}
+
+func (c *codecs) Decode(bytes []byte) (interface{}, error) {
+	v := c.newValue()
+	if err := c.m.Unmarshal(bytes, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// IDLen is the length of message ID preceding the message data of Registry,
+// in big-endian.
+const IDLen = 4
+
+// Registry is the Codecs of messages of registered types, the message data
+// is preceded by the ID of message type.
+type Registry struct {
+	m     Marshaler
+	mtx   sync.RWMutex
+	types map[uint32]reflect.Type
+	ids   map[reflect.Type]uint32
+}
+
+// NewRegistry returns the Registry coding the messages in format of m.
+func NewRegistry(m Marshaler) *Registry {
+	return &Registry{
+		m:     m,
+		types: make(map[uint32]reflect.Type),
+		ids:   make(map[reflect.Type]uint32),
+	}
+}
+
+// Register maps id to the type of message v, which is a pointer, e.g.,
+// (*Login)(nil). The messages of the type are decoded as new pointers.
+func (r *Registry) Register(id uint32, v interface{}) error {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return ErrInvalidType
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if _, ok := r.types[id]; ok {
+		return ErrDuplicateID
+	}
+	if _, ok := r.ids[t]; ok {
+		return ErrDuplicateType
+	}
+	r.types[id] = t
+	r.ids[t] = id
+	return nil
+}
+
+// ID returns the ID of message type of v.
+func (r *Registry) ID(v interface{}) (uint32, bool) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	id, ok := r.ids[reflect.TypeOf(v)]
+	return id, ok
+}
+
+func (r *Registry) Encode(o interface{}) (session.Message, error) {
+	id, ok := r.ID(o)
+	if !ok {
+		return nil, ErrUnregisteredType
+	}
+
+	buf := getBuffer()
+	var b [IDLen]byte
+	binary.BigEndian.PutUint32(b[:], id)
+	buf.Write(b[:])
+	if err := r.m.Marshal(buf, o); err != nil {
+		putBuffer(buf)
+		return nil, err
+	}
+	return &message{buf: buf}, nil
+}
+
+func (r *Registry) Decode(bytes []byte) (interface{}, error) {
+	if len(bytes) < IDLen {
+		return nil, ErrShortMessage
+	}
+
+	id := binary.BigEndian.Uint32(bytes)
+	r.mtx.RLock()
+	t, ok := r.types[id]
+	r.mtx.RUnlock()
+	if !ok {
+		return nil, ErrUnknownID
+	}
+
+	v := reflect.New(t.Elem()).Interface()
+	if err := r.m.Unmarshal(bytes[IDLen:], v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
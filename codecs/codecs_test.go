@@ -0,0 +1,192 @@
+package codecs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/Godyy/go-net/session"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type login struct {
+	User  string
+	Token []byte
+}
+
+type chat struct {
+	Text string
+}
+
+// point is a protobuf-style message of two varints.
+type point struct {
+	X, Y int64
+}
+
+func (p *point) Marshal() ([]byte, error) {
+	b := make([]byte, 2*binary.MaxVarintLen64)
+	n := binary.PutVarint(b, p.X)
+	n += binary.PutVarint(b[n:], p.Y)
+	return b[:n], nil
+}
+
+func (p *point) Unmarshal(data []byte) error {
+	var n, m int
+	p.X, n = binary.Varint(data)
+	if n <= 0 {
+		return errors.New("invalid x")
+	}
+	p.Y, m = binary.Varint(data[n:])
+	if m <= 0 || n+m != len(data) {
+		return errors.New("invalid y")
+	}
+	return nil
+}
+
+// sizedPoint marshals into the buffer given.
+type sizedPoint struct {
+	point
+}
+
+func (p *sizedPoint) Size() int {
+	b, _ := p.point.Marshal()
+	return len(b)
+}
+
+func (p *sizedPoint) MarshalTo(data []byte) (int, error) {
+	b, _ := p.point.Marshal()
+	return copy(data, b), nil
+}
+
+func TestCodecs(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		codecs session.Codecs
+		msg    interface{}
+	}{
+		{"json", NewJSON(func() interface{} { return &login{} }), &login{User: "foo", Token: []byte{1, 2}}},
+		{"gob", NewGob(func() interface{} { return &login{} }), &login{User: "bar", Token: []byte{3}}},
+		{"proto", NewProto(func() interface{} { return &point{} }), &point{X: -1, Y: 300}},
+		{"sized proto", NewProto(func() interface{} { return &sizedPoint{} }), &sizedPoint{point{X: 7, Y: -7}}},
+	} {
+		msg, err := c.codecs.Encode(c.msg)
+		if err != nil {
+			t.Fatalf("%s: encode %v", c.name, err)
+		}
+		if msg.Length() != len(msg.Data()) {
+			t.Fatalf("%s: length %d of %d bytes", c.name, msg.Length(), len(msg.Data()))
+		}
+
+		o, err := c.codecs.Decode(msg.Data())
+		if err != nil || !reflect.DeepEqual(o, c.msg) {
+			t.Fatalf("%s: decode %+v, %v", c.name, o, err)
+		}
+		msg.Release()
+		msg.Release()
+	}
+
+	if _, err := NewProto(func() interface{} { return &point{} }).Encode(&login{}); err != ErrNotProto {
+		t.Fatalf("encode non-proto message, %v", err)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry(JSON)
+	if err := r.Register(1, (*login)(nil)); err != nil {
+		t.Fatalf("register login, %v", err)
+	}
+	if err := r.Register(2, &chat{}); err != nil {
+		t.Fatalf("register chat, %v", err)
+	}
+	for _, c := range []struct {
+		id  uint32
+		v   interface{}
+		err error
+	}{
+		{1, &chat{}, ErrDuplicateID},
+		{3, &chat{}, ErrDuplicateType},
+		{3, chat{}, ErrInvalidType},
+		{3, nil, ErrInvalidType},
+	} {
+		if err := r.Register(c.id, c.v); err != c.err {
+			t.Fatalf("register %d %T, %v", c.id, c.v, err)
+		}
+	}
+
+	msg, err := r.Encode(&chat{Text: "hello"})
+	if err != nil {
+		t.Fatalf("encode chat, %v", err)
+	}
+	if !bytes.Equal(msg.Data(), []byte("\x00\x00\x00\x02{\"Text\":\"hello\"}")) {
+		t.Fatalf("encode chat %q", msg.Data())
+	}
+	if o, err := r.Decode(msg.Data()); err != nil || o.(*chat).Text != "hello" {
+		t.Fatalf("decode chat %+v, %v", o, err)
+	}
+	msg.Release()
+
+	if _, err := r.Encode(&point{}); err != ErrUnregisteredType {
+		t.Fatalf("encode unregistered message, %v", err)
+	}
+	if _, err := r.Decode([]byte{0, 0, 0}); err != ErrShortMessage {
+		t.Fatalf("decode short message, %v", err)
+	}
+	if _, err := r.Decode([]byte{0, 0, 0, 9}); err != ErrUnknownID {
+		t.Fatalf("decode unknown message, %v", err)
+	}
+}
+
+func TestRegistrySession(t *testing.T) {
+	r := NewRegistry(Gob)
+	r.Register(1, (*login)(nil))
+	r.Register(2, (*chat)(nil))
+
+	listener, err := session.ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		srvSession, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		srvSession.SetCodecs(r)
+		srvSession.Start(func(s session.Session, e session.Event) {
+			if e.Type() == session.EventType_Message {
+				s.Send(e.Message())
+			}
+		})
+	}()
+
+	cliSession, err := session.ConnectTCP("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	defer cliSession.Close()
+
+	received := make(chan interface{}, 2)
+	cliSession.SetCodecs(r)
+	cliSession.Start(func(s session.Session, e session.Event) {
+		if e.Type() == session.EventType_Message {
+			received <- e.Message()
+		}
+	})
+
+	msgs := []interface{}{&login{User: "foo", Token: []byte("secret")}, &chat{Text: "hi"}}
+	for _, msg := range msgs {
+		cliSession.Send(msg)
+	}
+	for _, msg := range msgs {
+		select {
+		case o := <-received:
+			if !reflect.DeepEqual(o, msg) {
+				t.Fatalf("receive %+v, expected %+v", o, msg)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("wait message timeout")
+		}
+	}
+}
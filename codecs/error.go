@@ -0,0 +1,14 @@
+package codecs
+
+import "errors"
+
+var (
+	ErrNilValue         = errors.New("nil value factory")
+	ErrInvalidType      = errors.New("invalid message type")
+	ErrDuplicateID      = errors.New("duplicate message id")
+	ErrDuplicateType    = errors.New("duplicate message type")
+	ErrUnregisteredType = errors.New("message type not registered")
+	ErrUnknownID        = errors.New("unknown message id")
+	ErrShortMessage     = errors.New("message too short")
+	ErrNotProto         = errors.New("not protobuf message")
+)
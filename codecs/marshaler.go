@@ -0,0 +1,106 @@
+package codecs
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Marshaler marshals the values of messages in certain format.
+type Marshaler interface {
+	// Marshal appends the encoding of v to buf.
+	Marshal(buf *bytes.Buffer, v interface{}) error
+
+	// Unmarshal decodes data into v, which is a pointer. The data references
+	// the receive buffer of session, and must be copied if retained.
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// JSON marshals values with encoding/json.
+	JSON Marshaler = jsonMarshaler{}
+
+	// Gob marshals values with encoding/gob, each message carries the type
+	// information, since the messages are decoded independently.
+	Gob Marshaler = gobMarshaler{}
+
+	// Proto marshals the values implementing ProtoMessage, e.g., the messages
+	// generated by protobuf.
+	Proto Marshaler = protoMarshaler{}
+)
+
+type jsonMarshaler struct{}
+
+func (jsonMarshaler) Marshal(buf *bytes.Buffer, v interface{}) error {
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		return err
+	}
+	// trim the newline appended by encoder.
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
+
+func (jsonMarshaler) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobMarshaler struct{}
+
+func (gobMarshaler) Marshal(buf *bytes.Buffer, v interface{}) error {
+	return gob.NewEncoder(buf).Encode(v)
+}
+
+func (gobMarshaler) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// ProtoMessage is the protobuf-style message, marshaling itself.
+type ProtoMessage interface {
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+}
+
+// sizedProtoMessage is the ProtoMessage marshaling into the buffer given,
+// e.g., generated by gogo/protobuf.
+type sizedProtoMessage interface {
+	Size() int
+	MarshalTo(data []byte) (int, error)
+}
+
+type protoMarshaler struct{}
+
+func (protoMarshaler) Marshal(buf *bytes.Buffer, v interface{}) error {
+	pm, ok := v.(ProtoMessage)
+	if !ok {
+		return ErrNotProto
+	}
+
+	if sm, ok := v.(sizedProtoMessage); ok {
+		// marshal into the spare capacity of buffer, and then extend the
+		// buffer over it, the bytes copied onto themselves.
+		n := buf.Len()
+		buf.Grow(sm.Size())
+		b := buf.Bytes()[n : n+sm.Size()]
+		m, err := sm.MarshalTo(b)
+		if err != nil {
+			return err
+		}
+		buf.Write(b[:m])
+		return nil
+	}
+
+	b, err := pm.Marshal()
+	if err != nil {
+		return err
+	}
+	buf.Write(b)
+	return nil
+}
+
+func (protoMarshaler) Unmarshal(data []byte, v interface{}) error {
+	pm, ok := v.(ProtoMessage)
+	if !ok {
+		return ErrNotProto
+	}
+	return pm.Unmarshal(data)
+}
@@ -0,0 +1,43 @@
+package codecs
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxPooledSize is the max capacity of buffers returned to pool, the larger
+// ones are left to GC.
+const maxPooledSize = 64 * 1024
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledSize {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// message is the Message encoded into pooled buffer, the buffer is returned
+// to pool on release.
+type message struct {
+	buf *bytes.Buffer
+}
+
+func (m *message) Data() []byte { return m.buf.Bytes() }
+
+func (m *message) Length() int { return m.buf.Len() }
+
+func (m *message) Release() {
+	if m.buf != nil {
+		putBuffer(m.buf)
+		m.buf = nil
+	}
+}
@@ -1,60 +1,132 @@
 package queue
 
 import (
-	"errors"
-)
-
-var (
-	ErrQueueDestroyed = errors.New("queue had been destroyed")
+	"context"
+	"sync"
+	"sync/atomic"
 )
 
+// ChanQueue is the bounded Queue on channel. The channel is never closed,
+// so the pushes racing with Close fail with ErrQueueClosed instead of panic.
 type ChanQueue struct {
-	ch chan interface{}
+	ch        chan interface{}
+	closed    int32
+	closeOnce sync.Once
+	done      chan struct{}
 }
 
-func (q *ChanQueue) Size() int {
-	if q.ch == nil {
-		panic(ErrQueueDestroyed)
+func NewChanQueue(size int) *ChanQueue {
+	if size <= 0 {
+		panic("invalid size")
+	}
+	return &ChanQueue{
+		ch:   make(chan interface{}, size),
+		done: make(chan struct{}),
 	}
+}
 
+// Size returns the capacity of queue.
+func (q *ChanQueue) Size() int {
 	return cap(q.ch)
 }
 
-func (q *ChanQueue) Push(o interface{}) {
-	if q.ch == nil {
-		panic(ErrQueueDestroyed)
+// Len returns the number of elements in queue.
+func (q *ChanQueue) Len() int {
+	return len(q.ch)
+}
+
+// Push pushes o, waits until queue not full.
+func (q *ChanQueue) Push(o interface{}) error {
+	return q.PushContext(nil, o)
+}
+
+// TryPush pushes o if queue not full, or returns ErrQueueFull.
+func (q *ChanQueue) TryPush(o interface{}) error {
+	if o == nil {
+		return ErrNilElement
+	}
+	if atomic.LoadInt32(&q.closed) != 0 {
+		return ErrQueueClosed
 	}
 
-	q.ch <- o
+	select {
+	case q.ch <- o:
+		return nil
+	default:
+		return ErrQueueFull
+	}
 }
 
-func (q *ChanQueue) Pop(wait bool) (o interface{}) {
-	if q.ch == nil {
-		panic(ErrQueueDestroyed)
+// PushContext pushes o, waits until queue not full or ctx done.
+func (q *ChanQueue) PushContext(ctx context.Context, o interface{}) error {
+	if o == nil {
+		return ErrNilElement
+	}
+	if atomic.LoadInt32(&q.closed) != 0 {
+		return ErrQueueClosed
 	}
 
-	if !wait {
-		select {
-		case o = <-q.ch:
-		default:
+	select {
+	case q.ch <- o:
+		return nil
+	case <-q.done:
+		return ErrQueueClosed
+	case <-ctxDone(ctx):
+		return ctx.Err()
+	}
+}
+
+// Pop pops the element, waits until queue not empty or closed if wait.
+// Returns nil if there is none.
+func (q *ChanQueue) Pop(wait bool) (o interface{}) {
+	select {
+	case o = <-q.ch:
+		return
+	default:
+		if !wait {
+			return
 		}
-	} else {
-		o = <-q.ch
+	}
+
+	select {
+	case o = <-q.ch:
+	case <-q.done:
+		// the elements pushed along with closing.
+		o, _ = q.tryPop()
 	}
 	return
 }
 
-// Destroy destroy the queue, i.e., close internal channel.
-func (q *ChanQueue) Destroy() {
-	if q.ch != nil {
-		close(q.ch)
-		q.ch = nil
-	}
+// PopBatch pops at most len(dst) elements into dst, returns the number of
+// elements popped. If wait, it waits until queue not empty or closed.
+func (q *ChanQueue) PopBatch(dst []interface{}, wait bool) int {
+	return popBatch(dst, wait, q.Pop, q.tryPop)
 }
 
-func NewChanQueue(size int) *ChanQueue {
-	if size <= 0 {
-		panic("invalid size")
+func (q *ChanQueue) tryPop() (interface{}, bool) {
+	select {
+	case o := <-q.ch:
+		return o, true
+	default:
+		return nil, false
 	}
-	return &ChanQueue{ch: make(chan interface{}, size)}
+}
+
+// Close closes the queue, the pushes fail with ErrQueueClosed and the
+// waiting pops return once queue empty.
+func (q *ChanQueue) Close() error {
+	err := ErrQueueClosed
+	q.closeOnce.Do(func() {
+		atomic.StoreInt32(&q.closed, 1)
+		close(q.done)
+		err = nil
+	})
+	return err
+}
+
+// Destroy closes the queue.
+//
+// Deprecated: use Close.
+func (q *ChanQueue) Destroy() {
+	q.Close()
 }
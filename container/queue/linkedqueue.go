@@ -0,0 +1,109 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+type linkedNode struct {
+	next unsafe.Pointer // *linkedNode
+	val  interface{}
+}
+
+// LinkedQueue is the unbounded queue on linked list, the pushes are lock-free
+// and never wait, the pops are serialized.
+type LinkedQueue struct {
+	head      unsafe.Pointer // 最后入队的节点
+	tail      *linkedNode    // 已出队的哨兵节点
+	popMtx    sync.Mutex
+	len       int64
+	closed    int32
+	closeOnce sync.Once
+	done      chan struct{}
+	notEmpty  signal
+}
+
+func NewLinkedQueue() *LinkedQueue {
+	stub := &linkedNode{}
+	return &LinkedQueue{
+		head:     unsafe.Pointer(stub),
+		tail:     stub,
+		done:     make(chan struct{}),
+		notEmpty: newSignal(),
+	}
+}
+
+func (q *LinkedQueue) Len() int {
+	if n := atomic.LoadInt64(&q.len); n > 0 {
+		return int(n)
+	}
+	return 0
+}
+
+func (q *LinkedQueue) Push(o interface{}) error {
+	return q.TryPush(o)
+}
+
+func (q *LinkedQueue) PushContext(ctx context.Context, o interface{}) error {
+	return q.TryPush(o)
+}
+
+func (q *LinkedQueue) TryPush(o interface{}) error {
+	if o == nil {
+		return ErrNilElement
+	}
+	if atomic.LoadInt32(&q.closed) != 0 {
+		return ErrQueueClosed
+	}
+
+	n := &linkedNode{val: o}
+	prev := (*linkedNode)(atomic.SwapPointer(&q.head, unsafe.Pointer(n)))
+	atomic.StorePointer(&prev.next, unsafe.Pointer(n))
+	atomic.AddInt64(&q.len, 1)
+	q.notEmpty.notify()
+	return nil
+}
+
+func (q *LinkedQueue) Pop(wait bool) interface{} {
+	o, ok := q.tryPop()
+	if ok || !wait {
+		return o
+	}
+
+	q.notEmpty.await(func() bool {
+		o, ok = q.tryPop()
+		return ok || atomic.LoadInt32(&q.closed) != 0
+	}, q.done, nil)
+	return o
+}
+
+func (q *LinkedQueue) PopBatch(dst []interface{}, wait bool) int {
+	return popBatch(dst, wait, q.Pop, q.tryPop)
+}
+
+func (q *LinkedQueue) tryPop() (interface{}, bool) {
+	q.popMtx.Lock()
+	defer q.popMtx.Unlock()
+
+	next := (*linkedNode)(atomic.LoadPointer(&q.tail.next))
+	if next == nil {
+		return nil, false
+	}
+	q.tail = next
+	o := next.val
+	next.val = nil
+	atomic.AddInt64(&q.len, -1)
+	return o, true
+}
+
+func (q *LinkedQueue) Close() error {
+	err := ErrQueueClosed
+	q.closeOnce.Do(func() {
+		atomic.StoreInt32(&q.closed, 1)
+		close(q.done)
+		err = nil
+	})
+	return err
+}
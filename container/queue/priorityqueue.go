@@ -0,0 +1,165 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// PriorityQueue is the multi-level FIFO queue, level 0 is the highest
+// priority. The higher levels are popped first, but a lower level waiting
+// is popped after burst successive pops of a higher level, to avoid
+// starvation.
+type PriorityQueue struct {
+	levels    []Queue
+	burst     int
+	mtx       sync.Mutex
+	served    []int // 各级连续出队次数
+	closed    int32
+	closeOnce sync.Once
+	done      chan struct{}
+	notEmpty  signal // 有元素入队的通知
+}
+
+// NewPriorityQueue returns the PriorityQueue of levels. Non-positive burst
+// disables the starvation protection.
+func NewPriorityQueue(levels []Queue, burst int) *PriorityQueue {
+	if len(levels) == 0 {
+		panic("invalid levels")
+	}
+
+	return &PriorityQueue{
+		levels:   levels,
+		burst:    burst,
+		served:   make([]int, len(levels)),
+		done:     make(chan struct{}),
+		notEmpty: newSignal(),
+	}
+}
+
+// NewRingPriorityQueue returns the PriorityQueue of levels on RingQueue of
+// size.
+func NewRingPriorityQueue(levels, size, burst int) *PriorityQueue {
+	if levels <= 0 {
+		panic("invalid levels")
+	}
+
+	qs := make([]Queue, levels)
+	for i := range qs {
+		qs[i] = NewRingQueue(size)
+	}
+	return NewPriorityQueue(qs, burst)
+}
+
+// Levels returns the number of levels.
+func (q *PriorityQueue) Levels() int { return len(q.levels) }
+
+// Len returns the number of elements in queue.
+func (q *PriorityQueue) Len() int {
+	n := 0
+	for _, l := range q.levels {
+		n += l.Len()
+	}
+	return n
+}
+
+// LevelLen returns the number of elements in level.
+func (q *PriorityQueue) LevelLen(level int) int {
+	return q.levels[level].Len()
+}
+
+// Push pushes o to level, waits until the level not full.
+func (q *PriorityQueue) Push(o interface{}, level int) error {
+	return q.pushed(q.levels[level].Push(o))
+}
+
+// TryPush pushes o to level if it's not full, or returns ErrQueueFull.
+func (q *PriorityQueue) TryPush(o interface{}, level int) error {
+	return q.pushed(q.levels[level].TryPush(o))
+}
+
+// PushContext pushes o to level, waits until the level not full or ctx done.
+func (q *PriorityQueue) PushContext(ctx context.Context, o interface{}, level int) error {
+	return q.pushed(q.levels[level].PushContext(ctx, o))
+}
+
+func (q *PriorityQueue) pushed(err error) error {
+	if err == nil {
+		q.notEmpty.notify()
+	}
+	return err
+}
+
+// Pop pops the element in priority, waits until queue not empty or closed
+// if wait. Returns nil if there is none.
+func (q *PriorityQueue) Pop(wait bool) interface{} {
+	o, ok := q.pop()
+	if ok || !wait {
+		return o
+	}
+
+	q.notEmpty.await(func() bool {
+		o, ok = q.pop()
+		return ok || atomic.LoadInt32(&q.closed) != 0
+	}, q.done, nil)
+	return o
+}
+
+// PopBatch pops at most len(dst) elements in priority into dst, returns the
+// number of elements popped.
+func (q *PriorityQueue) PopBatch(dst []interface{}, wait bool) int {
+	return popBatch(dst, wait, q.Pop, q.pop)
+}
+
+// PopLevel pops the element of level without waiting, returns nil if there
+// is none.
+func (q *PriorityQueue) PopLevel(level int) interface{} {
+	return q.levels[level].Pop(false)
+}
+
+func (q *PriorityQueue) pop() (interface{}, bool) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	for i, l := range q.levels {
+		if l.Len() == 0 {
+			q.served[i] = 0
+			continue
+		}
+		if q.burst > 0 && q.served[i] >= q.burst && q.lowerWaiting(i) {
+			// yield to lower levels.
+			q.served[i] = 0
+			continue
+		}
+
+		if o := l.Pop(false); o != nil {
+			q.served[i]++
+			return o, true
+		}
+	}
+	return nil, false
+}
+
+// lowerWaiting reports whether any level lower than level is not empty.
+func (q *PriorityQueue) lowerWaiting(level int) bool {
+	for _, l := range q.levels[level+1:] {
+		if l.Len() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Close closes all levels, the waiting Pop returns nil once queue empty.
+func (q *PriorityQueue) Close() error {
+	err := ErrQueueClosed
+	q.closeOnce.Do(func() {
+		for _, l := range q.levels {
+			l.Close()
+		}
+		atomic.StoreInt32(&q.closed, 1)
+		close(q.done)
+		err = nil
+	})
+	return err
+}
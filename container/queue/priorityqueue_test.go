@@ -0,0 +1,73 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueue(t *testing.T) {
+	q := NewRingPriorityQueue(3, 4, 2)
+	for i := 0; i < 4; i++ {
+		q.Push(i, 2)
+	}
+	q.Push("high", 0)
+	q.Push("normal", 1)
+	q.Push("high", 0)
+	q.Push("high", 0)
+	if q.Len() != 8 || q.LevelLen(0) != 3 {
+		t.Fatalf("len %d, level 0 len %d", q.Len(), q.LevelLen(0))
+	}
+
+	// the lower levels popped after 2 successive pops of higher level.
+	expected := []interface{}{"high", "high", "normal", "high", 0, 1, 2, 3}
+	for _, e := range expected {
+		if o := q.Pop(false); o != e {
+			t.Fatalf("pop %v, expected %v", o, e)
+		}
+	}
+	if o := q.Pop(false); o != nil {
+		t.Fatalf("pop %v from empty queue", o)
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := q.TryPush(i, 1); err != nil {
+			t.Fatalf("try push failed, %v", err)
+		}
+	}
+	if err := q.TryPush(4, 1); err != ErrQueueFull {
+		t.Fatalf("push to full level, %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.PushContext(ctx, 4, 1); err != context.DeadlineExceeded {
+		t.Fatalf("push to full level with context, %v", err)
+	}
+	if o := q.PopLevel(1); o != 0 {
+		t.Fatalf("pop level %v", o)
+	}
+
+	popped := make(chan interface{})
+	go func() {
+		for o := q.Pop(true); o != nil; o = q.Pop(true) {
+			popped <- o
+		}
+		close(popped)
+	}()
+	for _, e := range []interface{}{1, 2, 3} {
+		if o := <-popped; o != e {
+			t.Fatalf("pop %v, expected %v", o, e)
+		}
+	}
+	q.Push("wake", 2)
+	if o := <-popped; o != "wake" {
+		t.Fatalf("pop %v after waiting", o)
+	}
+	q.Close()
+	if _, ok := <-popped; ok {
+		t.Fatal("pop after closed")
+	}
+	if err := q.Push("closed", 0); err != ErrQueueClosed {
+		t.Fatalf("push after closed, %v", err)
+	}
+}
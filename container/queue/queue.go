@@ -0,0 +1,119 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+var (
+	ErrQueueClosed = errors.New("queue closed")
+	ErrQueueFull   = errors.New("queue full")
+	ErrNilElement  = errors.New("nil element")
+)
+
+// Queue is the FIFO queue safe for concurrent use. The elements remained
+// after closed can still be popped.
+type Queue interface {
+	// Push pushes o, waits until queue not full.
+	Push(o interface{}) error
+
+	// TryPush pushes o if queue not full, or returns ErrQueueFull.
+	TryPush(o interface{}) error
+
+	// PushContext pushes o, waits until queue not full or ctx done.
+	PushContext(ctx context.Context, o interface{}) error
+
+	// Pop pops the element, waits until queue not empty or closed if wait.
+	// Returns nil if there is none.
+	Pop(wait bool) interface{}
+
+	// PopBatch pops at most len(dst) elements into dst, returns the number
+	// of elements popped. If wait, it waits until queue not empty or closed.
+	PopBatch(dst []interface{}, wait bool) int
+
+	// Len returns the number of elements in queue.
+	Len() int
+
+	// Close closes the queue, the pushes fail with ErrQueueClosed and the
+	// waiting pops return once queue empty.
+	Close() error
+}
+
+// signal wakes the goroutines waiting for the change of queue.
+type signal struct {
+	waiting int32
+	ch      chan struct{}
+}
+
+func newSignal() signal { return signal{ch: make(chan struct{}, 1)} }
+
+// notify wakes a waiting goroutine if any.
+func (s *signal) notify() {
+	if atomic.LoadInt32(&s.waiting) > 0 {
+		select {
+		case s.ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// await calls try until it returns true, waits for signal, done or cancel
+// between tries. Returns false if cancelled.
+func (s *signal) await(try func() bool, done, cancel <-chan struct{}) bool {
+	for !try() {
+		atomic.AddInt32(&s.waiting, 1)
+		if try() {
+			atomic.AddInt32(&s.waiting, -1)
+			break
+		}
+
+		select {
+		case <-s.ch:
+		case <-done:
+		case <-cancel:
+			atomic.AddInt32(&s.waiting, -1)
+			return false
+		}
+		atomic.AddInt32(&s.waiting, -1)
+	}
+
+	// pass the signal to other waiters.
+	s.notify()
+	return true
+}
+
+// ctxDone returns the done channel of ctx, nil if ctx never done.
+func ctxDone(ctx context.Context) <-chan struct{} {
+	if ctx == nil {
+		return nil
+	}
+	return ctx.Done()
+}
+
+// popBatch pops the elements into dst by pop, waits for the first one by
+// waitPop if wait.
+func popBatch(dst []interface{}, wait bool, waitPop func(bool) interface{}, pop func() (interface{}, bool)) int {
+	if len(dst) == 0 {
+		return 0
+	}
+
+	n := 0
+	if wait {
+		o := waitPop(true)
+		if o == nil {
+			return 0
+		}
+		dst[0] = o
+		n = 1
+	}
+	for n < len(dst) {
+		o, ok := pop()
+		if !ok {
+			break
+		}
+		dst[n] = o
+		n++
+	}
+	return n
+}
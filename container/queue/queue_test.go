@@ -0,0 +1,189 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testQueue(t *testing.T, q Queue, size int) {
+	if err := q.Push(nil); err != ErrNilElement {
+		t.Fatalf("push nil, %v", err)
+	}
+
+	for i := 0; i < size; i++ {
+		if err := q.TryPush(i); err != nil {
+			t.Fatalf("try push %d, %v", i, err)
+		}
+	}
+	if q.Len() != size {
+		t.Fatalf("len %d, expected %d", q.Len(), size)
+	}
+	if o := q.Pop(false); o != 0 {
+		t.Fatalf("pop %v", o)
+	}
+	dst := make([]interface{}, 2)
+	if n := q.PopBatch(dst, false); n != 2 || dst[0] != 1 || dst[1] != 2 {
+		t.Fatalf("pop batch %d %v", n, dst[:n])
+	}
+	for i := 3; i < size; i++ {
+		if o := q.Pop(false); o != i {
+			t.Fatalf("pop %v, expected %d", o, i)
+		}
+	}
+	if o := q.Pop(false); o != nil {
+		t.Fatalf("pop %v from empty queue", o)
+	}
+
+	// multiple producers, popped in order of each producer.
+	const producers, n = 4, 1000
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				if err := q.Push([2]int{p, i}); err != nil {
+					t.Errorf("push, %v", err)
+					return
+				}
+			}
+		}(p)
+	}
+	next := make([]int, producers)
+	for popped := 0; popped < producers*n; {
+		c := q.PopBatch(dst, true)
+		for _, o := range dst[:c] {
+			e := o.([2]int)
+			if e[1] != next[e[0]] {
+				t.Fatalf("pop %v, expected %d", e, next[e[0]])
+			}
+			next[e[0]]++
+		}
+		popped += c
+	}
+	wg.Wait()
+
+	popped := make(chan interface{})
+	go func() {
+		popped <- q.Pop(true)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	q.Push("wake")
+	if o := <-popped; o != "wake" {
+		t.Fatalf("pop %v after waiting", o)
+	}
+
+	q.Push("remained")
+	if err := q.Close(); err != nil {
+		t.Fatalf("close, %v", err)
+	}
+	if err := q.Close(); err != ErrQueueClosed {
+		t.Fatalf("close again, %v", err)
+	}
+	if err := q.Push(1); err != ErrQueueClosed {
+		t.Fatalf("push after closed, %v", err)
+	}
+	if o := q.Pop(true); o != "remained" {
+		t.Fatalf("pop %v after closed", o)
+	}
+	if o := q.Pop(true); o != nil {
+		t.Fatalf("pop %v from closed queue", o)
+	}
+}
+
+func TestRingQueue(t *testing.T) {
+	q := NewRingQueue(6)
+	if q.Size() != 6 {
+		t.Fatalf("size %d", q.Size())
+	}
+	testQueue(t, q, 6)
+	if err := q.TryPush(1); err != ErrQueueClosed {
+		t.Fatalf("push to closed queue, %v", err)
+	}
+
+	q = NewRingQueue(1)
+	q.Push(1)
+	q.Push(2)
+	if err := q.TryPush(3); err != ErrQueueFull {
+		t.Fatalf("push to full queue, %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.PushContext(ctx, 3); err != context.DeadlineExceeded {
+		t.Fatalf("push to full queue with context, %v", err)
+	}
+
+	// the waiting push fails once closed.
+	pushed := make(chan error)
+	go func() {
+		pushed <- q.Push(3)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	q.Close()
+	if err := <-pushed; err != ErrQueueClosed {
+		t.Fatalf("waiting push after closed, %v", err)
+	}
+}
+
+func TestChanQueue(t *testing.T) {
+	testQueue(t, NewChanQueue(8), 8)
+
+	q := NewChanQueue(1)
+	q.Push(1)
+	if err := q.TryPush(2); err != ErrQueueFull {
+		t.Fatalf("push to full queue, %v", err)
+	}
+
+	// the waiting push fails once closed, instead of panic.
+	pushed := make(chan error)
+	go func() {
+		pushed <- q.Push(2)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	q.Close()
+	if err := <-pushed; err != ErrQueueClosed {
+		t.Fatalf("waiting push after closed, %v", err)
+	}
+}
+
+func TestLinkedQueue(t *testing.T) {
+	testQueue(t, NewLinkedQueue(), 100)
+}
+
+const benchQueueSize = 1024
+
+// benchmarkQueue pushes by parallel producers and pops by a consumer.
+func benchmarkQueue(b *testing.B, push func(interface{}), pop func() interface{}) {
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < b.N; i++ {
+			pop()
+		}
+		close(done)
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			push(1)
+		}
+	})
+	<-done
+}
+
+func BenchmarkChanQueue(b *testing.B) {
+	q := NewChanQueue(benchQueueSize)
+	benchmarkQueue(b, func(o interface{}) { q.Push(o) }, func() interface{} { return q.Pop(true) })
+}
+
+func BenchmarkRingQueue(b *testing.B) {
+	q := NewRingQueue(benchQueueSize)
+	benchmarkQueue(b, func(o interface{}) { q.Push(o) }, func() interface{} { return q.Pop(true) })
+}
+
+func BenchmarkLinkedQueue(b *testing.B) {
+	q := NewLinkedQueue()
+	benchmarkQueue(b, func(o interface{}) { q.Push(o) }, func() interface{} { return q.Pop(true) })
+}
@@ -0,0 +1,157 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// ringCell is the cell of RingQueue, seq tells whether it's ready for
+// pushing or popping.
+type ringCell struct {
+	seq uint64
+	val interface{}
+}
+
+// RingQueue is the bounded lock-free queue on ring buffer, for multiple
+// producers and consumers.
+type RingQueue struct {
+	tail      uint64   // 下一个入队位置
+	_         [56]byte // 避免伪共享
+	head      uint64   // 下一个出队位置
+	_         [56]byte
+	size      uint64
+	cells     []ringCell
+	closed    int32
+	closeOnce sync.Once
+	done      chan struct{}
+	notEmpty  signal
+	notFull   signal
+}
+
+// NewRingQueue returns the RingQueue of size, at least 2 which the sequence
+// of cells requires.
+func NewRingQueue(size int) *RingQueue {
+	if size <= 0 {
+		panic("invalid size")
+	}
+
+	if size < 2 {
+		size = 2
+	}
+	q := &RingQueue{
+		size:     uint64(size),
+		cells:    make([]ringCell, size),
+		done:     make(chan struct{}),
+		notEmpty: newSignal(),
+		notFull:  newSignal(),
+	}
+	for i := range q.cells {
+		q.cells[i].seq = uint64(i)
+	}
+	return q
+}
+
+// Size returns the capacity of queue.
+func (q *RingQueue) Size() int { return len(q.cells) }
+
+func (q *RingQueue) Len() int {
+	head := atomic.LoadUint64(&q.head)
+	tail := atomic.LoadUint64(&q.tail)
+	if tail <= head {
+		return 0
+	}
+	if n := int(tail - head); n < len(q.cells) {
+		return n
+	}
+	return len(q.cells)
+}
+
+func (q *RingQueue) Push(o interface{}) error {
+	return q.PushContext(nil, o)
+}
+
+func (q *RingQueue) PushContext(ctx context.Context, o interface{}) error {
+	var err error
+	if !q.notFull.await(func() bool {
+		err = q.TryPush(o)
+		return err != ErrQueueFull
+	}, q.done, ctxDone(ctx)) {
+		return ctx.Err()
+	}
+	return err
+}
+
+func (q *RingQueue) TryPush(o interface{}) error {
+	if o == nil {
+		return ErrNilElement
+	}
+
+	for {
+		if atomic.LoadInt32(&q.closed) != 0 {
+			return ErrQueueClosed
+		}
+
+		pos := atomic.LoadUint64(&q.tail)
+		c := &q.cells[pos%q.size]
+		seq := atomic.LoadUint64(&c.seq)
+		switch dif := int64(seq - pos); {
+		case dif == 0:
+			if atomic.CompareAndSwapUint64(&q.tail, pos, pos+1) {
+				c.val = o
+				atomic.StoreUint64(&c.seq, pos+1)
+				q.notEmpty.notify()
+				return nil
+			}
+		case dif < 0:
+			return ErrQueueFull
+		}
+	}
+}
+
+func (q *RingQueue) Pop(wait bool) interface{} {
+	o, ok := q.tryPop()
+	if ok || !wait {
+		return o
+	}
+
+	q.notEmpty.await(func() bool {
+		o, ok = q.tryPop()
+		return ok || atomic.LoadInt32(&q.closed) != 0
+	}, q.done, nil)
+	return o
+}
+
+func (q *RingQueue) PopBatch(dst []interface{}, wait bool) int {
+	return popBatch(dst, wait, q.Pop, q.tryPop)
+}
+
+func (q *RingQueue) tryPop() (interface{}, bool) {
+	for {
+		pos := atomic.LoadUint64(&q.head)
+		c := &q.cells[pos%q.size]
+		seq := atomic.LoadUint64(&c.seq)
+		switch dif := int64(seq - (pos + 1)); {
+		case dif == 0:
+			if atomic.CompareAndSwapUint64(&q.head, pos, pos+1) {
+				o := c.val
+				c.val = nil
+				atomic.StoreUint64(&c.seq, pos+q.size)
+				q.notFull.notify()
+				return o, true
+			}
+		case dif < 0:
+			return nil, false
+		}
+	}
+}
+
+func (q *RingQueue) Close() error {
+	err := ErrQueueClosed
+	q.closeOnce.Do(func() {
+		atomic.StoreInt32(&q.closed, 1)
+		close(q.done)
+		err = nil
+	})
+	return err
+}
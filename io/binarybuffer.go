@@ -109,7 +109,7 @@ func (b *Buffer) ReadUint64() (uint64, error) {
 		return 0, ErrBufferedNotEnough
 	}
 	value := binary.BigEndian.Uint64(b.buf[b.r:])
-	b.r += 4
+	b.r += 8
 	return value, nil
 }
 
@@ -128,14 +128,14 @@ func (b *Buffer) Read(bytes []byte) (n int, err error) {
 	return
 }
 
-func (b *Buffer) ReadFrom(reader io.Reader) (n int, err error) {
+func (b *Buffer) ReadFrom(reader io.Reader) (n int64, err error) {
 	if b.Available() == 0 {
 		return 0, ErrAvailableNotEnough
 	}
 
-	n, err = reader.Read(b.buf[b.w:])
-	b.w += n
-	return
+	read, err := reader.Read(b.buf[b.w:])
+	b.w += read
+	return int64(read), err
 }
 
 func (b *Buffer) WriteUint16(value uint16) error {
@@ -176,8 +176,8 @@ func (b *Buffer) Write(bytes []byte) (n int, err error) {
 	return
 }
 
-func (b *Buffer) WriteTo(writer io.Writer) (n int, err error) {
-	n, err = writer.Write(b.buf[b.r:b.w])
-	b.r += n
-	return
+func (b *Buffer) WriteTo(writer io.Writer) (n int64, err error) {
+	wrote, err := writer.Write(b.buf[b.r:b.w])
+	b.r += wrote
+	return int64(wrote), err
 }
@@ -0,0 +1,104 @@
+package io
+
+import (
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+// BytesPoolStats is the statistics of BytesPool.
+type BytesPoolStats struct {
+	Gets      uint64 // 获取次数
+	Puts      uint64 // 归还次数
+	News      uint64 // 池中无可用时新分配的次数
+	Oversized uint64 // 超过最大尺寸而不入池的次数
+	Discarded uint64 // 容量不符而丢弃的归还次数
+}
+
+// BytesPool is the tiered pool of byte slices, in size classes of powers of
+// 2 from the min size to the max size.
+type BytesPool struct {
+	stats    BytesPoolStats // 64位原子操作对齐
+	minShift uint
+	maxShift uint
+	maxSize  int
+	classes  []sync.Pool
+}
+
+// NewBytesPool returns the BytesPool of size classes from minSize to maxSize,
+// which are rounded up to powers of 2. The slices are allocated only when
+// got, so the large classes cost nothing if not used.
+func NewBytesPool(minSize, maxSize int) *BytesPool {
+	if minSize <= 0 || maxSize < minSize {
+		panic(ErrSizeLEZero)
+	}
+
+	minShift := shiftOf(minSize)
+	maxShift := shiftOf(maxSize)
+	p := &BytesPool{
+		minShift: minShift,
+		maxShift: maxShift,
+		maxSize:  maxSize,
+		classes:  make([]sync.Pool, maxShift-minShift+1),
+	}
+	for i := range p.classes {
+		size := 1 << (minShift + uint(i))
+		p.classes[i].New = func() interface{} {
+			atomic.AddUint64(&p.stats.News, 1)
+			b := make([]byte, size)
+			return &b
+		}
+	}
+	return p
+}
+
+// shiftOf returns the shift of the least power of 2 no less than size.
+func shiftOf(size int) uint {
+	return uint(bits.Len(uint(size - 1)))
+}
+
+// class returns the index of size class of size.
+func (p *BytesPool) class(size int) int {
+	if size <= 1<<p.minShift {
+		return 0
+	}
+	return int(shiftOf(size) - p.minShift)
+}
+
+// Get returns a byte slice of length size, the capacity of which is the
+// size class. The slice larger than the max size is allocated directly.
+func (p *BytesPool) Get(size int) []byte {
+	atomic.AddUint64(&p.stats.Gets, 1)
+	if size > p.maxSize {
+		atomic.AddUint64(&p.stats.Oversized, 1)
+		return make([]byte, size)
+	}
+
+	b := p.classes[p.class(size)].Get().(*[]byte)
+	return (*b)[:size]
+}
+
+// Put returns the byte slice got from pool, it must not be used after that.
+// The slices of capacity not a size class are discarded.
+func (p *BytesPool) Put(b []byte) {
+	atomic.AddUint64(&p.stats.Puts, 1)
+	c := cap(b)
+	if c < 1<<p.minShift || c&(c-1) != 0 || shiftOf(c) > p.maxShift {
+		atomic.AddUint64(&p.stats.Discarded, 1)
+		return
+	}
+
+	b = b[:c]
+	p.classes[p.class(c)].Put(&b)
+}
+
+// Stats returns the statistics of pool.
+func (p *BytesPool) Stats() BytesPoolStats {
+	return BytesPoolStats{
+		Gets:      atomic.LoadUint64(&p.stats.Gets),
+		Puts:      atomic.LoadUint64(&p.stats.Puts),
+		News:      atomic.LoadUint64(&p.stats.News),
+		Oversized: atomic.LoadUint64(&p.stats.Oversized),
+		Discarded: atomic.LoadUint64(&p.stats.Discarded),
+	}
+}
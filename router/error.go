@@ -0,0 +1,10 @@
+package router
+
+import "errors"
+
+var (
+	ErrInvalidHandler = errors.New("invalid handler")
+	ErrNoHandler      = errors.New("no handler for message")
+	ErrMessageType    = errors.New("message type mismatch")
+	ErrHandlerPanic   = errors.New("handler panic")
+)
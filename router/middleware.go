@@ -0,0 +1,51 @@
+package router
+
+import (
+	"fmt"
+	"github.com/Godyy/go-net/session"
+	"log"
+	"runtime/debug"
+	"time"
+)
+
+// Recovery recovers the handler from panic, the panic is reported as error.
+func Recovery() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(s session.Session, msg interface{}) (err error) {
+			defer func() {
+				if v := recover(); v != nil {
+					err = fmt.Errorf("%w: %v\n%s", ErrHandlerPanic, v, debug.Stack())
+				}
+			}()
+			return next(s, msg)
+		}
+	}
+}
+
+// Logging logs the message handled, the time elapsed and the error returned.
+func Logging(l *log.Logger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(s session.Session, msg interface{}) error {
+			start := time.Now()
+			err := next(s, msg)
+			if err != nil {
+				l.Printf("session %d handle %T in %s, error: %s", s.ID(), msg, time.Since(start), err)
+			} else {
+				l.Printf("session %d handle %T in %s", s.ID(), msg, time.Since(start))
+			}
+			return err
+		}
+	}
+}
+
+// Auth rejects the message if check returns error, which is reported.
+func Auth(check func(s session.Session, msg interface{}) error) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(s session.Session, msg interface{}) error {
+			if err := check(s, msg); err != nil {
+				return err
+			}
+			return next(s, msg)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package router
+
+import (
+	"fmt"
+	"github.com/Godyy/go-net/session"
+	"reflect"
+	"sync"
+)
+
+// HandlerFunc handles the message received by session.
+type HandlerFunc func(s session.Session, msg interface{}) error
+
+// Middleware wraps the handler, e.g., to log, authorize or recover.
+type Middleware func(HandlerFunc) HandlerFunc
+
+// IDMessage is implemented by the messages dispatched by ID.
+type IDMessage interface {
+	MessageID() uint32
+}
+
+var (
+	sessionType = reflect.TypeOf((*session.Session)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Router dispatches the messages received to the handlers registered by
+// Go type or message ID, the handler of type is preferred. It is used as
+// the EventCallback of sessions, the events other than message are passed
+// to the EventCallback given, as well as the errors returned by handlers
+// which are reported as ErrorType_Handler.
+type Router struct {
+	evtCB       session.EventCallback
+	mtx         sync.RWMutex
+	byType      map[reflect.Type]HandlerFunc
+	byID        map[uint32]HandlerFunc
+	fallback    HandlerFunc
+	middlewares []Middleware
+}
+
+func NewRouter(evtCB session.EventCallback) *Router {
+	return &Router{
+		evtCB:  evtCB,
+		byType: make(map[reflect.Type]HandlerFunc),
+		byID:   make(map[uint32]HandlerFunc),
+	}
+}
+
+// Handle registers the handler for the messages of ID. The handler is a
+// function of form func(session.Session, T) or func(session.Session, T)
+// error, it's an error if the message of ID is not assignable to T.
+func (r *Router) Handle(id uint32, handler interface{}) {
+	h, _ := adapt(handler)
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.byID[id] = h
+}
+
+// HandleType registers the handler for the messages of type T, the handler
+// is a function of form func(session.Session, T) or func(session.Session, T)
+// error, T must not be interface.
+func (r *Router) HandleType(handler interface{}) {
+	h, t := adapt(handler)
+	if t == nil || t.Kind() == reflect.Interface {
+		panic(ErrInvalidHandler)
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.byType[t] = h
+}
+
+// SetFallback sets the handler for the messages no handler registered for.
+// Without fallback, ErrNoHandler is reported.
+func (r *Router) SetFallback(h HandlerFunc) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.fallback = h
+}
+
+// Use appends the middlewares, which wrap all the handlers and fallback.
+// The middleware appended first runs first.
+func (r *Router) Use(mws ...Middleware) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.middlewares = append(r.middlewares, mws...)
+}
+
+// OnEvent is the EventCallback to start sessions.
+func (r *Router) OnEvent(s session.Session, evt session.Event) {
+	if evt.Type() != session.EventType_Message {
+		if r.evtCB != nil {
+			r.evtCB(s, evt)
+		}
+		return
+	}
+
+	msg := evt.Message()
+	if err := r.handler(msg)(s, msg); err != nil && r.evtCB != nil {
+		r.evtCB(s, session.NewErrorEvent(session.ErrorType_Handler, fmt.Errorf("handle %T: %w", msg, err)))
+	}
+}
+
+// handler returns the handler of message wrapped by middlewares.
+func (r *Router) handler(msg interface{}) HandlerFunc {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	h, ok := r.byType[reflect.TypeOf(msg)]
+	if !ok {
+		if m, isID := msg.(IDMessage); isID {
+			h, ok = r.byID[m.MessageID()]
+		}
+	}
+	if !ok {
+		if r.fallback != nil {
+			h = r.fallback
+		} else {
+			h = noHandler
+		}
+	}
+
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		h = r.middlewares[i](h)
+	}
+	return h
+}
+
+func noHandler(s session.Session, msg interface{}) error {
+	return ErrNoHandler
+}
+
+// adapt converts the handler function to HandlerFunc, returns the type of
+// messages it accepts.
+func adapt(handler interface{}) (HandlerFunc, reflect.Type) {
+	switch h := handler.(type) {
+	case HandlerFunc:
+		return h, nil
+	case func(session.Session, interface{}) error:
+		return h, nil
+	}
+
+	v := reflect.ValueOf(handler)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		panic(ErrInvalidHandler)
+	}
+	t := v.Type()
+	if t.NumIn() != 2 || t.In(0) != sessionType || t.NumOut() > 1 || (t.NumOut() == 1 && t.Out(0) != errorType) {
+		panic(ErrInvalidHandler)
+	}
+
+	msgType := t.In(1)
+	return func(s session.Session, msg interface{}) error {
+		mv := reflect.ValueOf(msg)
+		if !mv.IsValid() || !mv.Type().AssignableTo(msgType) {
+			return fmt.Errorf("%w, %s expected", ErrMessageType, msgType)
+		}
+
+		out := v.Call([]reflect.Value{reflect.ValueOf(&s).Elem(), mv})
+		if len(out) == 1 && !out[0].IsNil() {
+			return out[0].Interface().(error)
+		}
+		return nil
+	}, msgType
+}
@@ -0,0 +1,214 @@
+package router
+
+import (
+	"bytes"
+	"errors"
+	"github.com/Godyy/go-net/session"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	msgLogin = 1
+	msgChat  = 2
+)
+
+type login struct{ user string }
+type chat struct{ text string }
+type ping struct{}
+type unknown struct{}
+
+func (m *login) MessageID() uint32 { return msgLogin }
+func (m *chat) MessageID() uint32  { return msgChat }
+
+// testCodecs codes the messages with a leading type byte.
+type testCodecs struct{}
+
+func (c *testCodecs) Encode(o interface{}) (session.Message, error) {
+	switch msg := o.(type) {
+	case *login:
+		return session.NewMessage(append([]byte{msgLogin}, msg.user...)), nil
+	case *chat:
+		return session.NewMessage(append([]byte{msgChat}, msg.text...)), nil
+	case *ping:
+		return session.NewMessage([]byte{3}), nil
+	case *unknown:
+		return session.NewMessage([]byte{4}), nil
+	default:
+		return nil, errors.New("unknown message")
+	}
+}
+
+func (c *testCodecs) Decode(b []byte) (interface{}, error) {
+	switch b[0] {
+	case msgLogin:
+		return &login{user: string(b[1:])}, nil
+	case msgChat:
+		return &chat{text: string(b[1:])}, nil
+	case 3:
+		return &ping{}, nil
+	default:
+		return &unknown{}, nil
+	}
+}
+
+// syncWriter serializes the writes by mtx.
+type syncWriter struct {
+	mtx *sync.Mutex
+	w   io.Writer
+}
+
+func (w syncWriter) Write(b []byte) (int, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return w.w.Write(b)
+}
+
+func TestRouter(t *testing.T) {
+	listener, err := session.ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	var (
+		mtx      sync.Mutex
+		handled  []string
+		errs     []error
+		done     = make(chan struct{})
+		logBuf   bytes.Buffer
+		loggedIn bool
+	)
+	record := func(s string) {
+		mtx.Lock()
+		handled = append(handled, s)
+		mtx.Unlock()
+	}
+
+	r := NewRouter(func(s session.Session, e session.Event) {
+		if e.Type() == session.EventType_Error {
+			if e.Error().Type() != session.ErrorType_Handler {
+				t.Errorf("error type %s", e.Error().Type())
+			}
+			mtx.Lock()
+			errs = append(errs, e.Error())
+			mtx.Unlock()
+		}
+	})
+	// done after the last message logged.
+	last := func(next HandlerFunc) HandlerFunc {
+		return func(s session.Session, msg interface{}) error {
+			err := next(s, msg)
+			if _, ok := msg.(*unknown); ok {
+				close(done)
+			}
+			return err
+		}
+	}
+	r.Use(last, Recovery(), Logging(log.New(syncWriter{mtx: &mtx, w: &logBuf}, "", 0)), Auth(func(s session.Session, msg interface{}) error {
+		if _, ok := msg.(*login); !ok && !loggedIn {
+			return errors.New("not logged in")
+		}
+		return nil
+	}))
+	r.Handle(msgLogin, func(s session.Session, m *login) {
+		loggedIn = true
+		record("login " + m.user)
+	})
+	r.Handle(msgChat, func(s session.Session, m *chat) error {
+		if m.text == "panic" {
+			panic("chat panic")
+		}
+		record("chat " + m.text)
+		return nil
+	})
+	// handler of type is preferred.
+	r.HandleType(func(s session.Session, m *ping) error {
+		return errors.New("ping failed")
+	})
+	r.SetFallback(func(s session.Session, msg interface{}) error {
+		record("fallback")
+		return nil
+	})
+
+	go func() {
+		srvSession, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		srvSession.SetCodecs(&testCodecs{})
+		srvSession.Start(r.OnEvent)
+	}()
+
+	cliSession, err := session.ConnectTCP("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	cliSession.SetCodecs(&testCodecs{})
+	cliSession.Start(func(s session.Session, e session.Event) {})
+	defer cliSession.Close()
+
+	for _, msg := range []interface{}{
+		&chat{text: "rejected"},
+		&login{user: "foo"},
+		&chat{text: "hello"},
+		&chat{text: "panic"},
+		&ping{},
+		&unknown{},
+	} {
+		cliSession.Send(msg)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait messages handled timeout")
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	if strings.Join(handled, ",") != "login foo,chat hello,fallback" {
+		t.Fatalf("handled %q", handled)
+	}
+	if len(errs) != 3 {
+		t.Fatalf("errors %v", errs)
+	}
+	if !strings.Contains(errs[0].Error(), "not logged in") ||
+		!errors.Is(errs[1], ErrHandlerPanic) ||
+		!strings.Contains(errs[2].Error(), "ping failed") {
+		t.Fatalf("errors %v", errs)
+	}
+	if n := strings.Count(logBuf.String(), "\n"); n != 5 {
+		t.Fatalf("logged %d lines:\n%s", n, logBuf.String())
+	}
+}
+
+func TestRouterInvalidHandler(t *testing.T) {
+	r := NewRouter(nil)
+	for _, h := range []interface{}{
+		nil,
+		func(m *login) {},
+		func(s session.Session, m *login) int { return 0 },
+		func(s session.Session, m interface{}) {},
+	} {
+		func() {
+			defer func() {
+				if recover() != ErrInvalidHandler {
+					t.Errorf("handler %T accepted", h)
+				}
+			}()
+			r.HandleType(h)
+		}()
+	}
+}
+
+func TestRouterMessageType(t *testing.T) {
+	h, _ := adapt(func(s session.Session, m *login) {})
+	if err := h(nil, &chat{}); !errors.Is(err, ErrMessageType) {
+		t.Fatalf("handle returns %v", err)
+	}
+}
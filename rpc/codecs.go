@@ -0,0 +1,92 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"github.com/Godyy/go-net/session"
+)
+
+// Packet kinds.
+const (
+	kindMessage  = 0 // 普通消息
+	kindRequest  = 1 // 请求
+	kindResponse = 2 // 响应
+	kindEmpty    = 3 // 无内容的响应
+	kindError    = 4 // 错误响应
+)
+
+// headerLen is the length of packet header, 1 byte kind followed by 4 bytes
+// big-endian sequence ID.
+const headerLen = 5
+
+// packet is the request or response transmitted.
+type packet struct {
+	kind byte
+	seq  uint32
+	body interface{}
+}
+
+// codecs wraps the codecs of user messages with packet header.
+type codecs struct {
+	c session.Codecs
+}
+
+// NewCodecs returns the codecs to be set to sessions for RPC. The messages
+// sent directly by session are delivered to peer as ordinary messages.
+func NewCodecs(c session.Codecs) session.Codecs {
+	if c == nil {
+		panic(session.ErrNilCodecs)
+	}
+	return &codecs{c: c}
+}
+
+func (c *codecs) Encode(o interface{}) (session.Message, error) {
+	p, ok := o.(*packet)
+	if !ok {
+		p = &packet{kind: kindMessage, body: o}
+	}
+
+	var body []byte
+	switch p.kind {
+	case kindEmpty:
+	case kindError:
+		body = []byte(p.body.(string))
+	default:
+		msg, err := c.c.Encode(p.body)
+		if err != nil {
+			return nil, err
+		}
+		body = msg.Data()[:msg.Length()]
+		defer msg.Release()
+	}
+
+	data := make([]byte, headerLen+len(body))
+	data[0] = p.kind
+	binary.BigEndian.PutUint32(data[1:], p.seq)
+	copy(data[headerLen:], body)
+	return session.NewMessage(data), nil
+}
+
+func (c *codecs) Decode(bytes []byte) (interface{}, error) {
+	if len(bytes) < headerLen {
+		return nil, ErrInvalidPacket
+	}
+
+	p := &packet{kind: bytes[0], seq: binary.BigEndian.Uint32(bytes[1:])}
+	body := bytes[headerLen:]
+	switch p.kind {
+	case kindMessage:
+		return c.c.Decode(body)
+	case kindRequest, kindResponse:
+		o, err := c.c.Decode(body)
+		if err != nil {
+			return nil, err
+		}
+		p.body = o
+	case kindEmpty:
+	case kindError:
+		p.body = string(body)
+	default:
+		return nil, ErrInvalidPacket
+	}
+	return p, nil
+}
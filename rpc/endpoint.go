@@ -0,0 +1,251 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"github.com/Godyy/go-net/session"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Handler handles the request received and returns the response. The error
+// returned is delivered to caller as RemoteError. If both response and
+// error are nil, caller gets nil response.
+type Handler interface {
+	ServeRPC(s session.Session, req interface{}) (interface{}, error)
+}
+
+// HandlerFunc is an adapter to allow the use of function as Handler.
+type HandlerFunc func(s session.Session, req interface{}) (interface{}, error)
+
+func (f HandlerFunc) ServeRPC(s session.Session, req interface{}) (interface{}, error) {
+	return f(s, req)
+}
+
+// result is the result of call.
+type result struct {
+	resp interface{}
+	err  error
+}
+
+// Endpoint is the EventCallback of RPC sessions, i.e., the sessions whose
+// codecs are returned by NewCodecs. It dispatches the requests received to
+// handlers registered, and routes the responses to callers. The other events
+// are passed to the EventCallback given, as well as the errors of RPC which
+// are reported as ErrorType_RPC.
+type Endpoint struct {
+	evtCB    session.EventCallback
+	seq      uint32
+	timeout  time.Duration
+	mtx      sync.RWMutex
+	handlers map[reflect.Type]Handler
+	pending  map[uint64]map[uint32]chan result // 会话ID -> 请求序号 -> 等待响应的调用
+}
+
+func NewEndpoint(evtCB session.EventCallback) *Endpoint {
+	return &Endpoint{
+		evtCB:    evtCB,
+		handlers: make(map[reflect.Type]Handler),
+		pending:  make(map[uint64]map[uint32]chan result),
+	}
+}
+
+// SetTimeout sets the timeout of calls whose context has no deadline.
+func (e *Endpoint) SetTimeout(timeout time.Duration) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.timeout = timeout
+}
+
+// Handle registers the handler for the requests of the same type as req.
+func (e *Endpoint) Handle(req interface{}, h Handler) {
+	if req == nil {
+		panic(ErrNilRequest)
+	}
+	if h == nil {
+		panic(ErrNilHandler)
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.handlers[reflect.TypeOf(req)] = h
+}
+
+// HandleFunc registers the handler function for the requests of the same
+// type as req.
+func (e *Endpoint) HandleFunc(req interface{}, f func(s session.Session, req interface{}) (interface{}, error)) {
+	e.Handle(req, HandlerFunc(f))
+}
+
+// Call sends the request by session and waits for the response until ctx
+// done or session closed.
+func (e *Endpoint) Call(ctx context.Context, s session.Session, req interface{}) (interface{}, error) {
+	if req == nil {
+		return nil, ErrNilRequest
+	}
+
+	e.mtx.RLock()
+	timeout := e.timeout
+	e.mtx.RUnlock()
+	if _, ok := ctx.Deadline(); !ok && timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var (
+		sid = s.ID()
+		seq = atomic.AddUint32(&e.seq, 1)
+		ch  = make(chan result, 1)
+	)
+
+	e.mtx.Lock()
+	calls := e.pending[sid]
+	if calls == nil {
+		calls = make(map[uint32]chan result)
+		e.pending[sid] = calls
+	}
+	calls[seq] = ch
+	e.mtx.Unlock()
+
+	if err := s.Send(&packet{kind: kindRequest, seq: seq, body: req}); err != nil {
+		e.removeCall(sid, seq)
+		return nil, err
+	}
+
+	select {
+	case r := <-ch:
+		return r.resp, r.err
+	case <-ctx.Done():
+		e.removeCall(sid, seq)
+		return nil, ctx.Err()
+	}
+}
+
+func (e *Endpoint) removeCall(sid uint64, seq uint32) chan result {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	calls := e.pending[sid]
+	ch, ok := calls[seq]
+	if !ok {
+		return nil
+	}
+	delete(calls, seq)
+	if len(calls) == 0 {
+		delete(e.pending, sid)
+	}
+	return ch
+}
+
+// OnEvent is the EventCallback to start sessions.
+func (e *Endpoint) OnEvent(s session.Session, evt session.Event) {
+	switch evt.Type() {
+	case session.EventType_Message:
+		if p, ok := evt.Message().(*packet); ok {
+			e.handlePacket(s, p)
+			return
+		}
+
+	case session.EventType_Close:
+		// fail the calls waiting for response.
+		e.mtx.Lock()
+		calls := e.pending[s.ID()]
+		delete(e.pending, s.ID())
+		e.mtx.Unlock()
+
+		for _, ch := range calls {
+			ch <- result{err: ErrSessionClosed}
+		}
+	}
+
+	if e.evtCB != nil {
+		e.evtCB(s, evt)
+	}
+}
+
+func (e *Endpoint) handlePacket(s session.Session, p *packet) {
+	var r result
+	switch p.kind {
+	case kindRequest:
+		// serve concurrently, handler may call peer too.
+		go e.serve(s, p)
+		return
+	case kindResponse:
+		r.resp = p.body
+	case kindError:
+		r.err = RemoteError(p.body.(string))
+	}
+
+	ch := e.removeCall(s.ID(), p.seq)
+	if ch == nil {
+		// caller gave up waiting.
+		e.notifyError(s, fmt.Errorf("%w, seq %d", ErrOrphanedResponse, p.seq))
+		return
+	}
+	ch <- r
+}
+
+func (e *Endpoint) serve(s session.Session, req *packet) {
+	e.mtx.RLock()
+	h := e.handlers[reflect.TypeOf(req.body)]
+	e.mtx.RUnlock()
+
+	var (
+		resp interface{}
+		err  = fmt.Errorf("%w %T", ErrNoHandler, req.body)
+	)
+	if h != nil {
+		resp, err = h.ServeRPC(s, req.body)
+	}
+
+	p := &packet{seq: req.seq}
+	switch {
+	case err != nil:
+		p.kind, p.body = kindError, err.Error()
+	case resp == nil:
+		p.kind = kindEmpty
+	default:
+		p.kind, p.body = kindResponse, resp
+	}
+
+	if err := s.Send(p); err != nil {
+		if err == session.ErrSessionClosed || err == session.ErrSessionClosing {
+			return
+		}
+
+		// response can not be encoded, tell caller the error.
+		e.notifyError(s, err)
+		if p.kind == kindResponse {
+			s.Send(&packet{kind: kindError, seq: req.seq, body: err.Error()})
+		}
+	}
+}
+
+func (e *Endpoint) notifyError(s session.Session, err error) {
+	if e.evtCB != nil {
+		e.evtCB(s, session.NewErrorEvent(session.ErrorType_RPC, err))
+	}
+}
+
+// Client calls the remote procedures by session.
+type Client struct {
+	e *Endpoint
+	s session.Session
+}
+
+// NewClient returns the client calling by session, which must be started
+// with the EventCallback of endpoint.
+func NewClient(e *Endpoint, s session.Session) *Client {
+	return &Client{e: e, s: s}
+}
+
+// Call sends the request and waits for the response until ctx done.
+func (c *Client) Call(ctx context.Context, req interface{}) (interface{}, error) {
+	return c.e.Call(ctx, c.s, req)
+}
+
+// Session returns the session which client calls by.
+func (c *Client) Session() session.Session { return c.s }
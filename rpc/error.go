@@ -0,0 +1,17 @@
+package rpc
+
+import "errors"
+
+var (
+	ErrNilHandler       = errors.New("nil handler")
+	ErrNilRequest       = errors.New("nil request")
+	ErrNoHandler        = errors.New("no handler for request")
+	ErrInvalidPacket    = errors.New("invalid rpc packet")
+	ErrOrphanedResponse = errors.New("orphaned response")
+	ErrSessionClosed    = errors.New("session closed before response")
+)
+
+// RemoteError is the error returned by the handler of peer.
+type RemoteError string
+
+func (e RemoteError) Error() string { return string(e) }
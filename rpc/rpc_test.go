@@ -0,0 +1,239 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"github.com/Godyy/go-net/session"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type echoReq struct{ text string }
+type echoResp struct{ text string }
+type sleepReq struct{ d time.Duration }
+type failReq struct{}
+
+// testCodecs codes the messages with a leading type byte.
+type testCodecs struct{}
+
+func (c *testCodecs) Encode(o interface{}) (session.Message, error) {
+	switch msg := o.(type) {
+	case *echoReq:
+		return session.NewMessage(append([]byte{1}, msg.text...)), nil
+	case *echoResp:
+		return session.NewMessage(append([]byte{2}, msg.text...)), nil
+	case *sleepReq:
+		return session.NewMessage(append([]byte{3}, msg.d.String()...)), nil
+	case *failReq:
+		return session.NewMessage([]byte{4}), nil
+	default:
+		return nil, errors.New("unknown message")
+	}
+}
+
+func (c *testCodecs) Decode(b []byte) (interface{}, error) {
+	if len(b) == 0 {
+		return nil, errors.New("empty message")
+	}
+	switch b[0] {
+	case 1:
+		return &echoReq{text: string(b[1:])}, nil
+	case 2:
+		return &echoResp{text: string(b[1:])}, nil
+	case 3:
+		d, err := time.ParseDuration(string(b[1:]))
+		return &sleepReq{d: d}, err
+	case 4:
+		return &failReq{}, nil
+	default:
+		return nil, errors.New("unknown message")
+	}
+}
+
+// paddedCodecs pads the data of messages beyond their length.
+type paddedCodecs struct{ testCodecs }
+
+type paddedMessage struct{ session.Message }
+
+func (c *paddedCodecs) Encode(o interface{}) (session.Message, error) {
+	m, err := c.testCodecs.Encode(o)
+	if err != nil {
+		return nil, err
+	}
+	return paddedMessage{m}, nil
+}
+
+func (m paddedMessage) Data() []byte { return append(m.Message.Data(), 0xff) }
+
+func TestCodecsLength(t *testing.T) {
+	c := NewCodecs(&paddedCodecs{})
+	m, err := c.Encode(&echoReq{text: "hi"})
+	if err != nil {
+		t.Fatalf("encode failed, %s", err)
+	}
+	o, err := c.Decode(m.Data()[:m.Length()])
+	if req, ok := o.(*echoReq); err != nil || !ok || req.text != "hi" {
+		t.Fatalf("decode %+v, %v", o, err)
+	}
+}
+
+func TestRPC(t *testing.T) {
+	listener, err := session.ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	srvEndpoint := NewEndpoint(nil)
+	srvEndpoint.HandleFunc((*echoReq)(nil), func(s session.Session, req interface{}) (interface{}, error) {
+		return &echoResp{text: req.(*echoReq).text}, nil
+	})
+	srvEndpoint.HandleFunc((*sleepReq)(nil), func(s session.Session, req interface{}) (interface{}, error) {
+		time.Sleep(req.(*sleepReq).d)
+		return nil, nil
+	})
+	srvEndpoint.HandleFunc((*failReq)(nil), func(s session.Session, req interface{}) (interface{}, error) {
+		return nil, errors.New("failed")
+	})
+
+	go func() {
+		srvSession, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		srvSession.SetCodecs(NewCodecs(&testCodecs{}))
+		srvSession.Start(srvEndpoint.OnEvent)
+	}()
+
+	cliSession, err := session.ConnectTCP("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	var (
+		orphaned      int32
+		clientMessage = make(chan interface{}, 1)
+	)
+	cliEndpoint := NewEndpoint(func(s session.Session, e session.Event) {
+		switch e.Type() {
+		case session.EventType_Message:
+			clientMessage <- e.Message()
+		case session.EventType_Error:
+			if errors.Is(e.Error(), ErrOrphanedResponse) {
+				atomic.AddInt32(&orphaned, 1)
+			}
+		}
+	})
+	cliSession.SetCodecs(NewCodecs(&testCodecs{}))
+	cliSession.Start(cliEndpoint.OnEvent)
+	defer cliSession.Close()
+
+	cli := NewClient(cliEndpoint, cliSession)
+	ctx := context.Background()
+
+	// concurrent calls are routed to their callers.
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		go func(text string) {
+			resp, err := cli.Call(ctx, &echoReq{text: text})
+			if err == nil && resp.(*echoResp).text != text {
+				err = errors.New("response mismatch: " + resp.(*echoResp).text)
+			}
+			errs <- err
+		}(time.Duration(i).String())
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("call failed, %s", err)
+		}
+	}
+
+	if resp, err := cli.Call(ctx, &sleepReq{}); resp != nil || err != nil {
+		t.Fatalf("call returns %v, %v", resp, err)
+	}
+
+	if _, err := cli.Call(ctx, &failReq{}); err != RemoteError("failed") {
+		t.Fatalf("call returns error %v", err)
+	}
+
+	if _, err := cli.Call(ctx, &echoResp{}); !errors.As(err, new(RemoteError)) {
+		t.Fatalf("call without handler returns error %v", err)
+	}
+
+	// response arriving after timeout is orphaned.
+	cliEndpoint.SetTimeout(20 * time.Millisecond)
+	if _, err := cli.Call(ctx, &sleepReq{d: 100 * time.Millisecond}); err != context.DeadlineExceeded {
+		t.Fatalf("call returns error %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&orphaned) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("orphaned response not reported")
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	// cancellation.
+	cancelCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := cli.Call(cancelCtx, &sleepReq{d: 50 * time.Millisecond}); err != context.Canceled {
+		t.Fatalf("call returns error %v", err)
+	}
+
+	// ordinary messages are passed through.
+	srvEndpoint.HandleFunc((*echoReq)(nil), func(s session.Session, req interface{}) (interface{}, error) {
+		s.Send(&echoResp{text: "push"})
+		return nil, nil
+	})
+	cliEndpoint.SetTimeout(0)
+	if _, err := cli.Call(ctx, &echoReq{}); err != nil {
+		t.Fatalf("call failed, %s", err)
+	}
+	select {
+	case msg := <-clientMessage:
+		if m, ok := msg.(*echoResp); !ok || m.text != "push" {
+			t.Fatalf("client receive %v", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait message timeout")
+	}
+}
+
+func TestRPCSessionClosed(t *testing.T) {
+	listener, err := session.ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	// server closes session without response.
+	go func() {
+		srvSession, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		srvSession.SetCodecs(NewCodecs(&testCodecs{}))
+		srvSession.Start(func(s session.Session, e session.Event) {
+			if e.Type() == session.EventType_Message {
+				s.Close()
+			}
+		})
+	}()
+
+	cliSession, err := session.ConnectTCP("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	cliEndpoint := NewEndpoint(nil)
+	cliSession.SetCodecs(NewCodecs(&testCodecs{}))
+	cliSession.Start(cliEndpoint.OnEvent)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := NewClient(cliEndpoint, cliSession).Call(ctx, &echoReq{}); err != ErrSessionClosed {
+		t.Fatalf("call returns error %v", err)
+	}
+}
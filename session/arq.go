@@ -0,0 +1,1038 @@
+package session
+
+import (
+	"encoding/binary"
+	goio "io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	ARQDefaultMaxMsgSize    = 65536
+	ARQDefaultMTU           = 1400
+	ARQDefaultSendWindow    = 32
+	ARQDefaultReceiveWindow = 128
+	ARQDefaultInterval      = 100 * time.Millisecond
+
+	// ARQDeadLink is the max transmission times of a segment, the peer is
+	// considered unreachable if exceeded.
+	ARQDeadLink = 20
+)
+
+// ARQ segment commands.
+const (
+	arqCmdPush  = 81 // 数据
+	arqCmdAck   = 82 // 确认
+	arqCmdWask  = 83 // 询问窗口
+	arqCmdWins  = 84 // 告知窗口
+	arqCmdClose = 85 // 关闭连接
+)
+
+const (
+	arqOverhead    = 24
+	arqMaxFragment = 255
+	arqRTODefault  = 200
+	arqRTOMin      = 100
+	arqRTONoDelay  = 30
+	arqRTOMax      = 60000
+	arqThreshInit  = 2
+	arqThreshMin   = 2
+	arqProbeInit   = 7000
+	arqProbeLimit  = 120000
+
+	arqAskSend = 1 << 0 // 需要发送窗口询问
+	arqAskTell = 1 << 1 // 需要告知窗口大小
+)
+
+// ARQSession is a session delivering messages reliably and orderly over UDP,
+// using the KCP-style automatic repeat request. Each message is transmitted
+// in segments, and reassembled before decoding.
+type ARQSession struct {
+	packetSession
+}
+
+func newArqSession(conn *arqConn) *ARQSession {
+	s := &ARQSession{}
+	s.packetSession = newPacketSession(s, conn, ARQDefaultMaxMsgSize)
+	return s
+}
+
+func (s *ARQSession) arqConn() *arqConn { return s.conn.(*arqConn) }
+
+// Start starts the session and the transmission of connection, a session not
+// started holds no resources but the connection.
+func (s *ARQSession) Start(evtCB EventCallback) error {
+	if err := s.packetSession.Start(evtCB); err != nil {
+		return err
+	}
+	s.arqConn().run()
+	return nil
+}
+
+// SetMaxMessage sets the max size of message, before session started. It is
+// limited by the fragments of a message and the receiving window, so that
+// the messages too large are rejected by Send.
+func (s *ARQSession) SetMaxMessage(size int) error {
+	if size > s.arqConn().maxMessage() {
+		return ErrMaxMsgSize
+	}
+	return s.packetSession.SetMaxMessage(size)
+}
+
+// limitMaxMessage lowers the max size of message to the limit of connection.
+func (s *ARQSession) limitMaxMessage() {
+	if max := s.arqConn().maxMessage(); s.maxMsgSize > max {
+		s.maxMsgSize = max
+	}
+}
+
+// SetNoDelay configures the transmission, before session started.
+// nodelay enables the fast retransmission timeout, interval is the interval
+// of the internal update, resend is the number of duplicated ACKs triggering
+// fast retransmission, zero to disable, nocwnd disables the congestion control.
+func (s *ARQSession) SetNoDelay(nodelay bool, interval time.Duration, resend int, nocwnd bool) error {
+	if interval <= 0 || resend < 0 {
+		return ErrARQConfig
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.isStarted(false) {
+		return ErrSessionStarted
+	}
+	if s.isClosed(false) {
+		return ErrSessionClosed
+	}
+
+	s.arqConn().setNoDelay(nodelay, interval, resend, nocwnd)
+	return nil
+}
+
+// SetWindowSize sets the sending and receiving window size in segments,
+// before session started. The max size of message is lowered if exceeds the
+// receiving window.
+func (s *ARQSession) SetWindowSize(sndwnd, rcvwnd int) error {
+	if sndwnd <= 0 || rcvwnd < 2 || rcvwnd > 0xffff {
+		return ErrARQConfig
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.isStarted(false) {
+		return ErrSessionStarted
+	}
+	if s.isClosed(false) {
+		return ErrSessionClosed
+	}
+
+	s.arqConn().setWindowSize(sndwnd, rcvwnd)
+	s.limitMaxMessage()
+	return nil
+}
+
+// SetMTU sets the max size of the UDP packets, before session started. The
+// max size of message is lowered if exceeds the fragments of MTU.
+func (s *ARQSession) SetMTU(mtu int) error {
+	if mtu <= arqOverhead || mtu > UDPMaxMsgSize {
+		return ErrARQConfig
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.isStarted(false) {
+		return ErrSessionStarted
+	}
+	if s.isClosed(false) {
+		return ErrSessionClosed
+	}
+
+	s.arqConn().setMTU(mtu)
+	s.limitMaxMessage()
+	return nil
+}
+
+// ARQListener accepts ARQ sessions from the peers of UDP socket.
+type ARQListener struct {
+	stats listenerStats // 会话统计
+	mux   *udpMux
+}
+
+func (l *ARQListener) Accept() (Session, error) {
+	return l.AcceptARQ()
+}
+
+func (l *ARQListener) AcceptARQ() (*ARQSession, error) {
+	if p, err := l.mux.accept(); err != nil {
+		return nil, err
+	} else {
+		// conversation is learnt from the first segment.
+		s := newArqSession(newArqConn(p, 0))
+		l.stats.accept(s)
+		return s, nil
+	}
+}
+
+// Close the listener and all the sessions accepted from it.
+func (l *ARQListener) Close() error {
+	return l.mux.close()
+}
+
+func (l *ARQListener) Network() string {
+	return l.mux.conn.LocalAddr().Network()
+}
+
+func (l *ARQListener) Addr() string {
+	return l.mux.conn.LocalAddr().String()
+}
+
+func (l *ARQListener) Stats() ListenerStats {
+	return l.stats.load()
+}
+
+func ListenARQ(network, addr string) (*ARQListener, error) {
+	if mux, err := listenUdpMux(network, addr); err != nil {
+		return nil, err
+	} else {
+		return &ARQListener{mux: mux}, nil
+	}
+}
+
+func ConnectARQ(network, addr string) (*ARQSession, error) {
+	return ConnectARQTimeout(network, addr, 0)
+}
+
+func ConnectARQTimeout(network, addr string, timeout time.Duration) (s *ARQSession, e error) {
+	switch network {
+	case "udp", "udp4", "udp6":
+		if conn, err := net.DialTimeout(network, addr, timeout); err == nil {
+			s = newArqSession(newArqConn(conn, rand.Uint32()|1))
+		} else {
+			e = err
+		}
+
+	default:
+		e = ErrUnknownNetwork
+	}
+
+	return
+}
+
+type arqSegment struct {
+	conv uint32
+	cmd  uint8
+	frg  uint8
+	wnd  uint16
+	ts   uint32
+	sn   uint32
+	una  uint32
+	data []byte
+
+	resendts uint32
+	rto      uint32
+	fastack  uint32
+	xmit     uint32
+}
+
+func (seg *arqSegment) encode(b []byte) []byte {
+	var hdr [arqOverhead]byte
+	binary.LittleEndian.PutUint32(hdr[0:], seg.conv)
+	hdr[4] = seg.cmd
+	hdr[5] = seg.frg
+	binary.LittleEndian.PutUint16(hdr[6:], seg.wnd)
+	binary.LittleEndian.PutUint32(hdr[8:], seg.ts)
+	binary.LittleEndian.PutUint32(hdr[12:], seg.sn)
+	binary.LittleEndian.PutUint32(hdr[16:], seg.una)
+	binary.LittleEndian.PutUint32(hdr[20:], uint32(len(seg.data)))
+	return append(append(b, hdr[:]...), seg.data...)
+}
+
+func timediff(later, earlier uint32) int32 { return int32(later - earlier) }
+
+// arqConn is a message-oriented connection implementing the automatic repeat
+// request over a packet connection. Each Write sends a message reliably and
+// each Read returns a message orderly.
+type arqConn struct {
+	conn  net.Conn
+	start time.Time
+
+	mtx        sync.Mutex
+	conv       uint32
+	mtu, mss   uint32
+	sndUna     uint32
+	sndNxt     uint32
+	rcvNxt     uint32
+	ssthresh   uint32
+	rxRttval   int32
+	rxSrtt     int32
+	rxRto      int32
+	rxMinrto   int32
+	sndWnd     uint32
+	rcvWnd     uint32
+	rmtWnd     uint32
+	cwnd       uint32
+	incr       uint32
+	probe      uint32
+	tsProbe    uint32
+	probeWait  uint32
+	interval   time.Duration
+	nodelay    bool
+	fastresend uint32
+	nocwnd     bool
+
+	sndQueue []*arqSegment
+	rcvQueue []*arqSegment
+	sndBuf   []*arqSegment
+	rcvBuf   []*arqSegment
+	acklist  []uint32
+	buffer   []byte
+
+	runOnce     sync.Once
+	readable    chan struct{}
+	writable    chan struct{}
+	rdeadline   time.Time
+	wdeadline   time.Time
+	eof         bool
+	closeQueued bool // 已发送关闭分片
+	closeErr    error
+	closed      chan struct{}
+}
+
+func newArqConn(conn net.Conn, conv uint32) *arqConn {
+	c := &arqConn{
+		conn:     conn,
+		start:    time.Now(),
+		conv:     conv,
+		ssthresh: arqThreshInit,
+		rxRto:    arqRTODefault,
+		rxMinrto: arqRTOMin,
+		sndWnd:   ARQDefaultSendWindow,
+		rcvWnd:   ARQDefaultReceiveWindow,
+		rmtWnd:   ARQDefaultReceiveWindow,
+		interval: ARQDefaultInterval,
+		readable: make(chan struct{}, 1),
+		writable: make(chan struct{}, 1),
+		closed:   make(chan struct{}),
+	}
+	c.setMTU(ARQDefaultMTU)
+	return c
+}
+
+// run starts the receiving and updating of connection, once.
+func (c *arqConn) run() {
+	c.runOnce.Do(func() {
+		go c.readLoop()
+		go c.updateLoop()
+	})
+}
+
+// maxMessage returns the max size of message could be sent, limited by the
+// fragments and receiving window.
+func (c *arqConn) maxMessage() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	frags := uint32(arqMaxFragment)
+	if c.rcvWnd-1 < frags {
+		frags = c.rcvWnd - 1
+	}
+	return int(frags * c.mss)
+}
+
+func (c *arqConn) setNoDelay(nodelay bool, interval time.Duration, resend int, nocwnd bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.nodelay = nodelay
+	if nodelay {
+		c.rxMinrto = arqRTONoDelay
+	} else {
+		c.rxMinrto = arqRTOMin
+	}
+	c.interval = interval
+	c.fastresend = uint32(resend)
+	c.nocwnd = nocwnd
+}
+
+func (c *arqConn) setWindowSize(sndwnd, rcvwnd int) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.sndWnd = uint32(sndwnd)
+	c.rcvWnd = uint32(rcvwnd)
+}
+
+func (c *arqConn) setMTU(mtu int) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.mtu = uint32(mtu)
+	c.mss = c.mtu - arqOverhead
+	c.buffer = make([]byte, 0, mtu)
+}
+
+func (c *arqConn) current() uint32 {
+	return uint32(time.Since(c.start) / time.Millisecond)
+}
+
+func (c *arqConn) notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func (c *arqConn) wait(ch chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-ch:
+		return nil
+	case <-timeout:
+		return errTimeout
+	case <-c.closed:
+		return c.closeErr
+	}
+}
+
+// Read reads the next message, the rest of message is discarded if b is
+// not large enough.
+func (c *arqConn) Read(b []byte) (int, error) {
+	for {
+		c.mtx.Lock()
+		if c.closeErr != nil {
+			err := c.closeErr
+			c.mtx.Unlock()
+			return 0, err
+		}
+		if n, ok := c.recv(b); ok {
+			c.mtx.Unlock()
+			return n, nil
+		}
+		if c.eof {
+			c.mtx.Unlock()
+			return 0, goio.EOF
+		}
+		deadline := c.rdeadline
+		c.mtx.Unlock()
+
+		if err := c.wait(c.readable, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write sends b as a message, it blocks if too many segments waiting to be
+// sent.
+func (c *arqConn) Write(b []byte) (int, error) {
+	for {
+		c.mtx.Lock()
+		if c.closeErr != nil {
+			err := c.closeErr
+			c.mtx.Unlock()
+			return 0, err
+		}
+		if uint32(len(c.sndQueue)) < 2*c.sndWnd {
+			err := c.send(b)
+			if err == nil && c.nodelay {
+				c.flush()
+			}
+			c.mtx.Unlock()
+			if err != nil {
+				return 0, err
+			}
+			return len(b), nil
+		}
+		deadline := c.wdeadline
+		c.mtx.Unlock()
+
+		if err := c.wait(c.writable, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (c *arqConn) closeWith(err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.closeErr == nil {
+		c.closeErr = err
+		close(c.closed)
+	}
+}
+
+// CloseWrite notifies peer that no more messages will be sent, by the close
+// segment following the messages, and waits for all of them acknowledged
+// until the write deadline.
+func (c *arqConn) CloseWrite() error {
+	c.mtx.Lock()
+	if c.closeErr == nil && !c.closeQueued {
+		// retransmitted until acknowledged as the data segments.
+		c.sndQueue = append(c.sndQueue, &arqSegment{cmd: arqCmdClose})
+		c.closeQueued = true
+	}
+	c.mtx.Unlock()
+
+	for {
+		c.mtx.Lock()
+		if c.closeErr != nil {
+			err := c.closeErr
+			c.mtx.Unlock()
+			return err
+		}
+		if len(c.sndQueue) == 0 && len(c.sndBuf) == 0 {
+			c.mtx.Unlock()
+			return nil
+		}
+		deadline := c.wdeadline
+		c.mtx.Unlock()
+
+		if err := c.wait(c.writable, deadline); err != nil {
+			return err
+		}
+	}
+}
+
+// Close notifies peer and close the connection, the close segment is sent
+// once without waiting for acknowledge.
+func (c *arqConn) Close() error {
+	c.mtx.Lock()
+	if c.closeErr == nil {
+		seg := arqSegment{conv: c.conv, cmd: arqCmdClose, sn: c.sndNxt, una: c.rcvNxt, ts: c.current()}
+		c.conn.Write(seg.encode(c.buffer[:0]))
+	}
+	c.mtx.Unlock()
+
+	c.closeWith(ErrConnClosed)
+	return c.conn.Close()
+}
+
+func (c *arqConn) LocalAddr() net.Addr  { return c.conn.LocalAddr() }
+func (c *arqConn) RemoteAddr() net.Addr { return c.conn.RemoteAddr() }
+
+func (c *arqConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *arqConn) SetReadDeadline(t time.Time) error {
+	c.mtx.Lock()
+	c.rdeadline = t
+	c.mtx.Unlock()
+	return nil
+}
+
+func (c *arqConn) SetWriteDeadline(t time.Time) error {
+	c.mtx.Lock()
+	c.wdeadline = t
+	c.mtx.Unlock()
+	return nil
+}
+
+func (c *arqConn) readLoop() {
+	buf := make([]byte, UDPMaxMsgSize+1)
+	for {
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			select {
+			case <-c.closed:
+				return
+			default:
+			}
+
+			if err == ErrListenerClosed || err == ErrConnClosed {
+				c.closeWith(err)
+				return
+			}
+			// such as ICMP port unreachable, wait for retransmission.
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+
+		c.mtx.Lock()
+		c.input(buf[:n])
+		if c.nodelay {
+			c.flush()
+		}
+		c.mtx.Unlock()
+	}
+}
+
+func (c *arqConn) updateLoop() {
+	for {
+		c.mtx.Lock()
+		interval := c.interval
+		c.mtx.Unlock()
+
+		select {
+		case <-c.closed:
+			return
+		case <-time.After(interval):
+		}
+
+		c.mtx.Lock()
+		c.flush()
+		c.mtx.Unlock()
+	}
+}
+
+// send splits the message into segments and queues them.
+func (c *arqConn) send(b []byte) error {
+	count := (uint32(len(b)) + c.mss - 1) / c.mss
+	if count == 0 {
+		count = 1
+	}
+	if count > arqMaxFragment || count >= c.rcvWnd {
+		return ErrMsgTooLarge
+	}
+
+	for i := uint32(0); i < count; i++ {
+		size := uint32(len(b))
+		if size > c.mss {
+			size = c.mss
+		}
+		seg := &arqSegment{data: make([]byte, size), frg: uint8(count - i - 1)}
+		copy(seg.data, b[:size])
+		b = b[size:]
+		c.sndQueue = append(c.sndQueue, seg)
+	}
+	return nil
+}
+
+// recv extracts the next complete message.
+func (c *arqConn) recv(b []byte) (int, bool) {
+	if len(c.rcvQueue) > 0 && c.rcvQueue[0].cmd == arqCmdClose {
+		// no more messages from peer.
+		c.rcvQueue = c.rcvQueue[1:]
+		c.eof = true
+		return 0, false
+	}
+	if len(c.rcvQueue) == 0 || len(c.rcvQueue) < int(c.rcvQueue[0].frg)+1 {
+		return 0, false
+	}
+
+	recover := uint32(len(c.rcvQueue)) >= c.rcvWnd
+
+	var n, count int
+	for _, seg := range c.rcvQueue {
+		n += copy(b[n:], seg.data)
+		count++
+		if seg.frg == 0 {
+			break
+		}
+	}
+	c.rcvQueue = c.rcvQueue[count:]
+	c.moveReceived()
+
+	if recover && uint32(len(c.rcvQueue)) < c.rcvWnd {
+		// tell peer the window recovered.
+		c.probe |= arqAskTell
+	}
+	return n, true
+}
+
+// moveReceived moves the continuous segments from receive buffer to queue.
+func (c *arqConn) moveReceived() {
+	count := 0
+	for _, seg := range c.rcvBuf {
+		if seg.sn != c.rcvNxt || uint32(len(c.rcvQueue)) >= c.rcvWnd {
+			break
+		}
+		c.rcvQueue = append(c.rcvQueue, seg)
+		c.rcvNxt++
+		count++
+	}
+	if count > 0 {
+		c.rcvBuf = c.rcvBuf[count:]
+		if len(c.rcvQueue) > 0 && len(c.rcvQueue) >= int(c.rcvQueue[0].frg)+1 {
+			c.notify(c.readable)
+		}
+	}
+}
+
+func (c *arqConn) updateAck(rtt int32) {
+	if c.rxSrtt == 0 {
+		c.rxSrtt = rtt
+		c.rxRttval = rtt / 2
+	} else {
+		delta := rtt - c.rxSrtt
+		if delta < 0 {
+			delta = -delta
+		}
+		c.rxRttval = (3*c.rxRttval + delta) / 4
+		c.rxSrtt = (7*c.rxSrtt + rtt) / 8
+		if c.rxSrtt < 1 {
+			c.rxSrtt = 1
+		}
+	}
+
+	interval := int32(c.interval / time.Millisecond)
+	if 4*c.rxRttval > interval {
+		interval = 4 * c.rxRttval
+	}
+	rto := c.rxSrtt + interval
+	if rto < c.rxMinrto {
+		rto = c.rxMinrto
+	} else if rto > arqRTOMax {
+		rto = arqRTOMax
+	}
+	c.rxRto = rto
+}
+
+func (c *arqConn) shrinkBuf() {
+	if len(c.sndBuf) > 0 {
+		c.sndUna = c.sndBuf[0].sn
+	} else {
+		c.sndUna = c.sndNxt
+	}
+}
+
+func (c *arqConn) parseAck(sn uint32) {
+	if timediff(sn, c.sndUna) < 0 || timediff(sn, c.sndNxt) >= 0 {
+		return
+	}
+	for i, seg := range c.sndBuf {
+		if seg.sn == sn {
+			c.sndBuf = append(c.sndBuf[:i], c.sndBuf[i+1:]...)
+			break
+		}
+		if timediff(sn, seg.sn) < 0 {
+			break
+		}
+	}
+}
+
+func (c *arqConn) parseUna(una uint32) {
+	count := 0
+	for _, seg := range c.sndBuf {
+		if timediff(una, seg.sn) <= 0 {
+			break
+		}
+		count++
+	}
+	c.sndBuf = c.sndBuf[count:]
+}
+
+func (c *arqConn) parseFastack(sn uint32) {
+	if timediff(sn, c.sndUna) < 0 || timediff(sn, c.sndNxt) >= 0 {
+		return
+	}
+	for _, seg := range c.sndBuf {
+		if timediff(sn, seg.sn) <= 0 {
+			break
+		}
+		seg.fastack++
+	}
+}
+
+func (c *arqConn) parseData(newseg *arqSegment) {
+	sn := newseg.sn
+	if timediff(sn, c.rcvNxt+c.rcvWnd) >= 0 || timediff(sn, c.rcvNxt) < 0 {
+		return
+	}
+
+	// insert into receive buffer orderly, drop duplicated.
+	i := len(c.rcvBuf)
+	for ; i > 0; i-- {
+		seg := c.rcvBuf[i-1]
+		if seg.sn == sn {
+			return
+		}
+		if timediff(sn, seg.sn) > 0 {
+			break
+		}
+	}
+	c.rcvBuf = append(c.rcvBuf, nil)
+	copy(c.rcvBuf[i+1:], c.rcvBuf[i:])
+	c.rcvBuf[i] = newseg
+
+	c.moveReceived()
+}
+
+// input handles a packet received.
+func (c *arqConn) input(data []byte) {
+	var (
+		prevUna = c.sndUna
+		maxack  uint32
+		flag    bool
+		current = c.current()
+	)
+
+	for len(data) >= arqOverhead {
+		conv := binary.LittleEndian.Uint32(data)
+		if c.conv == 0 {
+			// conversation of accepted connection.
+			c.conv = conv
+		}
+		if conv != c.conv {
+			return
+		}
+
+		seg := arqSegment{
+			cmd: data[4],
+			frg: data[5],
+			wnd: binary.LittleEndian.Uint16(data[6:]),
+			ts:  binary.LittleEndian.Uint32(data[8:]),
+			sn:  binary.LittleEndian.Uint32(data[12:]),
+			una: binary.LittleEndian.Uint32(data[16:]),
+		}
+		length := binary.LittleEndian.Uint32(data[20:])
+		data = data[arqOverhead:]
+		if uint32(len(data)) < length {
+			return
+		}
+
+		c.rmtWnd = uint32(seg.wnd)
+		c.parseUna(seg.una)
+		c.shrinkBuf()
+
+		switch seg.cmd {
+		case arqCmdAck:
+			if rtt := timediff(current, seg.ts); rtt >= 0 {
+				c.updateAck(rtt)
+			}
+			c.parseAck(seg.sn)
+			c.shrinkBuf()
+			if !flag || timediff(seg.sn, maxack) > 0 {
+				flag = true
+				maxack = seg.sn
+			}
+
+		case arqCmdPush, arqCmdClose:
+			// the close segment is ordered and acknowledged as data.
+			if timediff(seg.sn, c.rcvNxt+c.rcvWnd) < 0 {
+				c.acklist = append(c.acklist, seg.sn, seg.ts)
+				if timediff(seg.sn, c.rcvNxt) >= 0 {
+					seg.data = make([]byte, length)
+					copy(seg.data, data[:length])
+					c.parseData(&seg)
+				}
+			}
+
+		case arqCmdWask:
+			c.probe |= arqAskTell
+
+		case arqCmdWins:
+
+		default:
+			return
+		}
+
+		data = data[length:]
+	}
+
+	if flag {
+		c.parseFastack(maxack)
+	}
+
+	if timediff(c.sndUna, prevUna) > 0 {
+		// new data acknowledged, enlarge congestion window.
+		if c.cwnd < c.rmtWnd {
+			mss := c.mss
+			if c.cwnd < c.ssthresh {
+				c.cwnd++
+				c.incr += mss
+			} else {
+				if c.incr < mss {
+					c.incr = mss
+				}
+				c.incr += (mss*mss)/c.incr + mss/16
+				if (c.cwnd+1)*mss <= c.incr {
+					c.cwnd = (c.incr + mss - 1) / mss
+				}
+			}
+			if c.cwnd > c.rmtWnd {
+				c.cwnd = c.rmtWnd
+				c.incr = c.rmtWnd * mss
+			}
+		}
+		c.notify(c.writable)
+	}
+}
+
+func (c *arqConn) wndUnused() uint16 {
+	if uint32(len(c.rcvQueue)) < c.rcvWnd {
+		return uint16(c.rcvWnd - uint32(len(c.rcvQueue)))
+	}
+	return 0
+}
+
+// output appends the segment to packet buffer, the buffer is sent if full.
+func (c *arqConn) output(seg *arqSegment) {
+	if uint32(len(c.buffer)+arqOverhead+len(seg.data)) > c.mtu {
+		c.flushBuffer()
+	}
+	c.buffer = seg.encode(c.buffer)
+}
+
+func (c *arqConn) flushBuffer() {
+	if len(c.buffer) > 0 {
+		c.conn.Write(c.buffer)
+		c.buffer = c.buffer[:0]
+	}
+}
+
+// flush sends the acknowledges, window probes, new and retransmitted segments.
+func (c *arqConn) flush() {
+	if c.closeErr != nil {
+		return
+	}
+
+	var (
+		current = c.current()
+		seg     = arqSegment{conv: c.conv, wnd: c.wndUnused(), una: c.rcvNxt}
+	)
+
+	// acknowledges.
+	seg.cmd = arqCmdAck
+	for i := 0; i+1 < len(c.acklist); i += 2 {
+		seg.sn, seg.ts = c.acklist[i], c.acklist[i+1]
+		c.output(&seg)
+	}
+	c.acklist = c.acklist[:0]
+
+	// probe window size if remote window is zero.
+	if c.rmtWnd == 0 {
+		if c.probeWait == 0 {
+			c.probeWait = arqProbeInit
+			c.tsProbe = current + c.probeWait
+		} else if timediff(current, c.tsProbe) >= 0 {
+			c.probeWait += c.probeWait / 2
+			if c.probeWait > arqProbeLimit {
+				c.probeWait = arqProbeLimit
+			}
+			c.tsProbe = current + c.probeWait
+			c.probe |= arqAskSend
+		}
+	} else {
+		c.tsProbe = 0
+		c.probeWait = 0
+	}
+
+	seg.sn, seg.ts = 0, 0
+	if c.probe&arqAskSend != 0 {
+		seg.cmd = arqCmdWask
+		c.output(&seg)
+	}
+	if c.probe&arqAskTell != 0 {
+		seg.cmd = arqCmdWins
+		c.output(&seg)
+	}
+	c.probe = 0
+
+	// move segments from send queue to send buffer within window.
+	cwnd := c.sndWnd
+	if c.rmtWnd < cwnd {
+		cwnd = c.rmtWnd
+	}
+	if !c.nocwnd && c.cwnd < cwnd {
+		cwnd = c.cwnd
+	}
+	if cwnd == 0 {
+		cwnd = 1
+	}
+
+	moved := 0
+	for _, newseg := range c.sndQueue {
+		if timediff(c.sndNxt, c.sndUna+cwnd) >= 0 {
+			break
+		}
+		newseg.conv = c.conv
+		if newseg.cmd != arqCmdClose {
+			newseg.cmd = arqCmdPush
+		}
+		newseg.sn = c.sndNxt
+		newseg.resendts = current
+		newseg.rto = uint32(c.rxRto)
+		c.sndNxt++
+		c.sndBuf = append(c.sndBuf, newseg)
+		moved++
+	}
+	if moved > 0 {
+		c.sndQueue = c.sndQueue[moved:]
+		c.notify(c.writable)
+	}
+
+	// transmit the segments in send buffer.
+	resent := c.fastresend
+	if resent == 0 {
+		resent = 0xffffffff
+	}
+	rtomin := uint32(0)
+	if !c.nodelay {
+		rtomin = uint32(c.rxRto) >> 3
+	}
+
+	var change, lost bool
+	for _, s := range c.sndBuf {
+		needsend := false
+		if s.xmit == 0 {
+			needsend = true
+			s.xmit++
+			s.rto = uint32(c.rxRto)
+			s.resendts = current + s.rto + rtomin
+		} else if timediff(current, s.resendts) >= 0 {
+			needsend = true
+			s.xmit++
+			if c.nodelay {
+				s.rto += s.rto / 2
+			} else if uint32(c.rxRto) > s.rto {
+				s.rto += uint32(c.rxRto)
+			} else {
+				s.rto += s.rto
+			}
+			s.resendts = current + s.rto
+			lost = true
+		} else if s.fastack >= resent {
+			needsend = true
+			s.xmit++
+			s.fastack = 0
+			s.resendts = current + s.rto
+			change = true
+		}
+
+		if needsend {
+			s.ts = current
+			s.wnd = seg.wnd
+			s.una = c.rcvNxt
+			c.output(s)
+
+			if s.xmit >= ARQDeadLink {
+				c.flushBuffer()
+				c.closeErr = ErrPeerUnreachable
+				close(c.closed)
+				return
+			}
+		}
+	}
+	c.flushBuffer()
+
+	// update congestion window.
+	if change {
+		inflight := c.sndNxt - c.sndUna
+		c.ssthresh = inflight / 2
+		if c.ssthresh < arqThreshMin {
+			c.ssthresh = arqThreshMin
+		}
+		c.cwnd = c.ssthresh + resent
+		c.incr = c.cwnd * c.mss
+	}
+	if lost {
+		c.ssthresh = cwnd / 2
+		if c.ssthresh < arqThreshMin {
+			c.ssthresh = arqThreshMin
+		}
+		c.cwnd = 1
+		c.incr = c.mss
+	}
+	if c.cwnd < 1 {
+		c.cwnd = 1
+		c.incr = c.mss
+	}
+}
@@ -0,0 +1,177 @@
+package session
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// lossyConn drops part of the packets written until stopped.
+type lossyConn struct {
+	net.Conn
+	lossRate float64
+	stopped  int32
+}
+
+func (c *lossyConn) Write(b []byte) (int, error) {
+	if atomic.LoadInt32(&c.stopped) == 0 && rand.Float64() < c.lossRate {
+		return len(b), nil
+	}
+	return c.Conn.Write(b)
+}
+
+func TestARQ(t *testing.T) {
+	listener, err := ListenARQ("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	var (
+		sendMsgCount  = 100
+		clientReceive int32
+		srvReason     = make(chan string, 1)
+	)
+
+	go func() {
+		srvSession, err := listener.AcceptARQ()
+		if err != nil {
+			return
+		}
+		srvSession.SetCodecs(&tcpCodecs{})
+		srvSession.SetNoDelay(true, 10*time.Millisecond, 2, true)
+		srvSession.Start(func(s Session, e Event) {
+			switch e.Type() {
+			case EventType_Message:
+				msg := e.Message().(*stringMsg)
+				s.Send(&stringMsg{msg: append([]byte(nil), msg.msg...)})
+			case EventType_Close:
+				srvReason <- e.Reason()
+			}
+		})
+	}()
+
+	conn, err := net.Dial("udp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	lossy := &lossyConn{Conn: conn, lossRate: 0.2}
+	cliSession := newArqSession(newArqConn(lossy, rand.Uint32()|1))
+	cliSession.SetCodecs(&tcpCodecs{})
+	cliSession.SetNoDelay(true, 10*time.Millisecond, 2, true)
+	cliSession.Start(func(s Session, e Event) {
+		if e.Type() == EventType_Message {
+			msg := e.Message().(*stringMsg).msg
+			if seq := binary.BigEndian.Uint32(msg); int32(seq) != atomic.LoadInt32(&clientReceive) {
+				t.Errorf("receive msg %d out of order", seq)
+			}
+			atomic.AddInt32(&clientReceive, 1)
+		}
+	})
+
+	go func() {
+		for i := 0; i < sendMsgCount; i++ {
+			// some messages require fragmentation.
+			msg := make([]byte, 100+i*50)
+			binary.BigEndian.PutUint32(msg, uint32(i))
+			cliSession.Send(&stringMsg{msg: msg})
+		}
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for atomic.LoadInt32(&clientReceive) < int32(sendMsgCount) {
+		if time.Now().After(deadline) {
+			t.Fatalf("client receive %d", atomic.LoadInt32(&clientReceive))
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	// the close segment is sent unreliably.
+	atomic.StoreInt32(&lossy.stopped, 1)
+	cliSession.Close()
+	select {
+	case r := <-srvReason:
+		if r != CloseReason_RemoteClose {
+			t.Fatalf("close reason %q, expected %q", r, CloseReason_RemoteClose)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait close timeout")
+	}
+}
+
+// dropCloseConn drops the first packet beginning with close segment.
+type dropCloseConn struct {
+	net.Conn
+	dropped int32
+}
+
+func (c *dropCloseConn) Write(b []byte) (int, error) {
+	if len(b) > 4 && b[4] == arqCmdClose && atomic.CompareAndSwapInt32(&c.dropped, 0, 1) {
+		return len(b), nil
+	}
+	return c.Conn.Write(b)
+}
+
+func TestARQCloseGracefully(t *testing.T) {
+	listener, err := ListenARQ("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	srvReason := make(chan string, 1)
+	go func() {
+		srvSession, err := listener.AcceptARQ()
+		if err != nil {
+			return
+		}
+		srvSession.SetCodecs(&tcpCodecs{})
+		srvSession.SetNoDelay(true, 10*time.Millisecond, 2, true)
+		srvSession.Start(func(s Session, e Event) {
+			if e.Type() == EventType_Close {
+				srvReason <- e.Reason()
+			}
+		})
+	}()
+
+	conn, err := net.Dial("udp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	drop := &dropCloseConn{Conn: conn}
+	cliSession := newArqSession(newArqConn(drop, rand.Uint32()|1))
+	cliSession.SetCodecs(&tcpCodecs{})
+	cliSession.SetNoDelay(true, 10*time.Millisecond, 2, true)
+	if err := cliSession.SetMaxMessage(256 * ARQDefaultMTU); err != ErrMaxMsgSize {
+		t.Fatalf("set max message exceeding fragments, %v", err)
+	}
+	cliSession.SetWindowSize(ARQDefaultSendWindow, 8)
+	cliSession.Start(func(s Session, e Event) {})
+	if err := cliSession.Send(&stringMsg{msg: make([]byte, 8*ARQDefaultMTU)}); err != ErrMsgTooLarge {
+		t.Fatalf("send message exceeding window, %v", err)
+	}
+	cliSession.Send(&stringMsg{msg: []byte("bye")})
+
+	// the close segment lost is retransmitted.
+	start := time.Now()
+	if err := cliSession.CloseGracefully(5 * time.Second); err != nil {
+		t.Fatalf("close gracefully, %v", err)
+	}
+	if atomic.LoadInt32(&drop.dropped) == 0 {
+		t.Fatal("close segment not dropped")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("close gracefully takes %s", d)
+	}
+	select {
+	case r := <-srvReason:
+		if r != CloseReason_RemoteClose {
+			t.Fatalf("close reason %q, expected %q", r, CloseReason_RemoteClose)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait close timeout")
+	}
+}
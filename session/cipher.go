@@ -0,0 +1,150 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"math"
+)
+
+// Cipher encrypts and authenticates the messages of stream sessions, after
+// compression on sending and before decompression on receiving. The control
+// frames are encrypted too. Seal is called by the sending goroutine and Open
+// by the receiving goroutine only.
+type Cipher interface {
+	// The max length added to message data by Seal.
+	Overhead() int
+
+	// Seal appends the encrypted and authenticated data to dst.
+	Seal(dst, data []byte) ([]byte, error)
+
+	// Open appends the decrypted data to dst, fails with ErrAuthFailed if
+	// data not authenticated, e.g., forged or replayed.
+	Open(dst, data []byte) ([]byte, error)
+}
+
+// SetCipher sets the Cipher of messages, before session started. The session
+// is closed with reason CloseReason_AuthFailed if a message not
+// authenticated. The Framer must precede message data with its size, see
+// cipherFramer. The max size of message is lowered by the overhead of c.
+// Nil c disables the encryption.
+func (ss *streamSession) SetCipher(c Cipher) error {
+	ss.mtx.Lock()
+	defer ss.mtx.Unlock()
+
+	if ss.isStarted(false) {
+		return ErrSessionStarted
+	}
+	if ss.isClosed(false) {
+		return ErrSessionClosed
+	}
+
+	if c != nil && !cipherFramer(ss.framer) {
+		return ErrCipherConfig
+	}
+
+	ss.cipher = c
+	ss.limitMaxMessage()
+	return nil
+}
+
+// cipherFramer reports whether the Framer can carry encrypted messages, i.e.,
+// it writes the header of message size before message data. The header
+// embedded in message data breaks the authentication, and the messages
+// delimited or not framed can not be opened as a whole.
+func cipherFramer(f Framer) bool {
+	return f.HeaderLen() > 0 && trailerOf(f) == nil
+}
+
+// cipherOverhead returns the max length added to message data by Cipher.
+func (ss *streamSession) cipherOverhead() int {
+	if ss.cipher == nil {
+		return 0
+	}
+	return ss.cipher.Overhead()
+}
+
+// open returns the decrypted message data allocated from BytesPool.
+func (ss *streamSession) open(data []byte) ([]byte, error) {
+	b, err := ss.cipher.Open(BytesPool.Get(len(data))[:0], data)
+	if err != nil {
+		BytesPool.Put(b)
+		return nil, err
+	}
+	return b, nil
+}
+
+// aeadCipher implements Cipher with AEAD. The nonces are implicit counters
+// of each direction, so the frames replayed, reordered or dropped fail in
+// authentication.
+type aeadCipher struct {
+	aead      cipher.AEAD
+	sendNonce []byte
+	recvNonce []byte
+}
+
+// NewAEADCipher returns the Cipher with aead, e.g., AES-GCM or
+// ChaCha20-Poly1305 with the session key. The nonce of aead must be no
+// shorter than 12 bytes, and client differs between the peers to separate
+// the nonces of two directions.
+func NewAEADCipher(aead cipher.AEAD, client bool) (Cipher, error) {
+	if aead.NonceSize() < 12 {
+		return nil, ErrCipherConfig
+	}
+
+	c := &aeadCipher{
+		aead:      aead,
+		sendNonce: make([]byte, aead.NonceSize()),
+		recvNonce: make([]byte, aead.NonceSize()),
+	}
+	if client {
+		c.sendNonce[0] = 1
+	} else {
+		c.recvNonce[0] = 1
+	}
+	return c, nil
+}
+
+// NewAESGCMCipher returns the Cipher of AES-GCM with key of 16, 24 or 32
+// bytes, see NewAEADCipher.
+func NewAESGCMCipher(key []byte, client bool) (Cipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return NewAEADCipher(aead, client)
+}
+
+func (c *aeadCipher) Overhead() int { return c.aead.Overhead() }
+
+func (c *aeadCipher) Seal(dst, data []byte) ([]byte, error) {
+	if err := incNonce(c.sendNonce); err != nil {
+		return dst, err
+	}
+	return c.aead.Seal(dst, c.sendNonce, data, nil), nil
+}
+
+func (c *aeadCipher) Open(dst, data []byte) ([]byte, error) {
+	if err := incNonce(c.recvNonce); err != nil {
+		return dst, err
+	}
+	b, err := c.aead.Open(dst, c.recvNonce, data, nil)
+	if err != nil {
+		return dst, ErrAuthFailed
+	}
+	return b, nil
+}
+
+// incNonce increases the counter in the last 8 bytes of nonce.
+func incNonce(nonce []byte) error {
+	counter := binary.BigEndian.Uint64(nonce[len(nonce)-8:])
+	if counter == math.MaxUint64 {
+		return ErrNonceExhausted
+	}
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], counter+1)
+	return nil
+}
@@ -0,0 +1,244 @@
+package session
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAEADCipher(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	cli, _ := NewAESGCMCipher(key, true)
+	srv, _ := NewAESGCMCipher(key, false)
+	if _, err := NewAESGCMCipher(key[:10], true); err == nil {
+		t.Fatal("invalid key accepted")
+	}
+
+	data := []byte("session data")
+	sealed1, _ := cli.Seal(nil, data)
+	sealed2, _ := cli.Seal(nil, data)
+	if len(sealed1) != len(data)+cli.Overhead() || bytes.Equal(sealed1, sealed2) {
+		t.Fatalf("sealed %x, %x", sealed1, sealed2)
+	}
+
+	// nonces differ between directions.
+	if reply, _ := srv.Seal(nil, data); bytes.Equal(reply, sealed1) {
+		t.Fatal("nonce reused in both directions")
+	}
+
+	if b, err := srv.Open(nil, sealed1); err != nil || !bytes.Equal(b, data) {
+		t.Fatalf("open %q, %v", b, err)
+	}
+	if _, err := srv.Open(nil, sealed1); err != ErrAuthFailed {
+		t.Fatalf("open replayed data, %v", err)
+	}
+}
+
+func TestCipherSession(t *testing.T) {
+	listener, err := ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	var (
+		key        = bytes.Repeat([]byte{1}, 16)
+		compressor = mustGzipCompressor()
+		authErr    = make(chan struct{}, 2)
+		closed     = make(chan string, 2)
+	)
+	go func() {
+		for {
+			srvSession, err := listener.AcceptTCP()
+			if err != nil {
+				return
+			}
+			c, _ := NewAESGCMCipher(key, false)
+			srvSession.SetCodecs(&tcpCodecs{})
+			srvSession.SetCipher(c)
+			srvSession.SetCompression(compressor, 16)
+			srvSession.Start(func(s Session, e Event) {
+				switch e.Type() {
+				case EventType_Message:
+					msg := e.Message().(*stringMsg)
+					s.Send(&stringMsg{msg: append([]byte(nil), msg.msg...)})
+				case EventType_Error:
+					if e.Error().Type() == ErrorType_Auth {
+						authErr <- struct{}{}
+					}
+				case EventType_Close:
+					closed <- e.Reason()
+				}
+			})
+		}
+	}()
+
+	cliSession, err := ConnectTCP("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	defer cliSession.Close()
+
+	received := make(chan []byte, 10)
+	c, _ := NewAESGCMCipher(key, true)
+	cliSession.SetCodecs(&tcpCodecs{})
+	cliSession.SetCipher(c)
+	cliSession.SetCompression(compressor, 16)
+	cliSession.SetHeartbeat(10*time.Millisecond, 0, 3)
+	cliSession.Start(func(s Session, e Event) {
+		switch e.Type() {
+		case EventType_Message:
+			received <- append([]byte(nil), e.Message().(*stringMsg).msg...)
+		case EventType_Error:
+			t.Errorf("client error, %s", e.Error())
+		}
+	})
+
+	msgs := [][]byte{[]byte("hi"), bytes.Repeat([]byte("secret "), 100), make([]byte, TCPDefaultMaxMsgSize)}
+	for _, msg := range msgs {
+		cliSession.Send(&stringMsg{msg: msg})
+	}
+	for _, msg := range msgs {
+		select {
+		case b := <-received:
+			if !bytes.Equal(b, msg) {
+				t.Fatalf("receive msg len %d, expected %d", len(b), len(msg))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("wait message timeout")
+		}
+	}
+
+	// the control frames are encrypted.
+	waitFor(t, func() bool { return cliSession.RTT() > 0 }, "rtt not measured")
+
+	// forged message and control frame.
+	for _, frame := range [][]byte{
+		append([]byte{0, 0, 0, 20}, make([]byte, 20)...),
+		append([]byte{0x80, 0, 0, controlFrameLen + 16}, make([]byte, controlFrameLen+16)...),
+	} {
+		conn, err := net.Dial("tcp4", listener.Addr())
+		if err != nil {
+			t.Fatalf("connect server failed, %s", err)
+		}
+		defer conn.Close()
+		conn.Write(frame)
+
+		select {
+		case <-authErr:
+		case <-time.After(5 * time.Second):
+			t.Fatal("wait auth error timeout")
+		}
+		select {
+		case reason := <-closed:
+			if reason != CloseReason_AuthFailed {
+				t.Fatalf("close reason %s", reason)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("wait close timeout")
+		}
+	}
+}
+
+func mustGzipCompressor() Compressor {
+	c, err := NewGzipCompressor(-1)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func TestCipherFramer(t *testing.T) {
+	listener, err := ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	var (
+		key    = bytes.Repeat([]byte{1}, 16)
+		framer = NewLengthFramer(2, binary.BigEndian, false)
+	)
+	go func() {
+		srvSession, err := listener.AcceptTCP()
+		if err != nil {
+			return
+		}
+		c, _ := NewAESGCMCipher(key, false)
+		srvSession.SetCodecs(&tcpCodecs{})
+		srvSession.SetFramer(framer)
+		srvSession.SetCipher(c)
+		srvSession.Start(func(s Session, e Event) {
+			switch e.Type() {
+			case EventType_Message:
+				msg := e.Message().(*stringMsg)
+				s.Send(&stringMsg{msg: append([]byte(nil), msg.msg...)})
+			case EventType_Error:
+				t.Errorf("server error, %s", e.Error())
+			}
+		})
+	}()
+
+	cliSession, err := ConnectTCP("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	defer cliSession.Close()
+
+	// the framers not preceding message data with size.
+	c, _ := NewAESGCMCipher(key, true)
+	for _, f := range []Framer{
+		NewDelimiterFramer([]byte("\n")),
+		NewOffsetFramer(4, 0, 4, binary.BigEndian, true),
+		RawFramer,
+	} {
+		if err := cliSession.SetFramer(f); err != nil {
+			t.Fatalf("set framer, %v", err)
+		}
+		if err := cliSession.SetCipher(c); err != ErrCipherConfig {
+			t.Fatalf("set cipher with framer %T, %v", f, err)
+		}
+	}
+	cliSession.SetFramer(framer)
+	if err := cliSession.SetCipher(c); err != nil {
+		t.Fatalf("set cipher, %v", err)
+	}
+	if err := cliSession.SetFramer(NewDelimiterFramer([]byte("\n"))); err != ErrCipherConfig {
+		t.Fatalf("set delimiter framer with cipher, %v", err)
+	}
+
+	received := make(chan []byte, 10)
+	cliSession.SetCodecs(&tcpCodecs{})
+	cliSession.Start(func(s Session, e Event) {
+		switch e.Type() {
+		case EventType_Message:
+			received <- append([]byte(nil), e.Message().(*stringMsg).msg...)
+		case EventType_Error:
+			t.Errorf("client error, %s", e.Error())
+		}
+	})
+
+	// the message of max size, and the nonces keep in step.
+	max := 1<<16 - 1 - c.Overhead()
+	if err := cliSession.Send(&stringMsg{msg: make([]byte, max+1)}); err != ErrMsgTooLarge {
+		t.Fatalf("send message exceeding framer, %v", err)
+	}
+	msgs := [][]byte{bytes.Repeat([]byte{1}, max), []byte("hi")}
+	for _, msg := range msgs {
+		if err := cliSession.Send(&stringMsg{msg: msg}); err != nil {
+			t.Fatalf("send failed, %v", err)
+		}
+	}
+	for _, msg := range msgs {
+		select {
+		case b := <-received:
+			if !bytes.Equal(b, msg) {
+				t.Fatalf("receive msg len %d, expected %d", len(b), len(msg))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("wait message timeout")
+		}
+	}
+}
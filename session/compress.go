@@ -0,0 +1,192 @@
+package session
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// Compressor compresses the messages of stream sessions, the compressed
+// frames are flagged by FrameCompressed.
+type Compressor interface {
+	// Compress appends the compressed src to dst.
+	Compress(dst, src []byte) ([]byte, error)
+
+	// Decompress appends the decompressed src to dst, fails with
+	// ErrMsgTooLarge if the decompressed size exceeds limit.
+	Decompress(dst, src []byte, limit int) ([]byte, error)
+}
+
+// SetCompression enables the compression of messages no shorter than
+// threshold, before session started. The messages not getting smaller are
+// sent uncompressed. The compression is negotiated per session: once started,
+// the session advertises it to peer by a control frame, and compresses the
+// messages only after the advertisement of peer received, so the peer
+// without Compressor always receives uncompressed messages. The peers must
+// use the same compression format, the decompressed size is limited by the
+// max message size. Nil c disables the compression.
+func (ss *streamSession) SetCompression(c Compressor, threshold int) error {
+	if threshold < 0 {
+		return ErrCompressConfig
+	}
+
+	ss.mtx.Lock()
+	defer ss.mtx.Unlock()
+
+	if ss.isStarted(false) {
+		return ErrSessionStarted
+	}
+	if ss.isClosed(false) {
+		return ErrSessionClosed
+	}
+
+	ss.compressor = c
+	ss.compressThreshold = threshold
+	return nil
+}
+
+// compress returns the compressed data, or nil if not compressed.
+func (ss *streamSession) compress(data []byte) ([]byte, error) {
+	if len(data) < ss.compressThreshold {
+		return nil, nil
+	}
+
+	b, err := ss.compressor.Compress(nil, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) >= len(data) {
+		return nil, nil
+	}
+	return b, nil
+}
+
+// decompress returns the decompressed message data.
+func (ss *streamSession) decompress(data []byte) ([]byte, error) {
+	if ss.compressor == nil {
+		return nil, ErrCompressedFrame
+	}
+	return ss.compressor.Decompress(nil, data, ss.maxMsgSize)
+}
+
+// flateCompressor compresses in DEFLATE format, the writers and readers
+// are pooled.
+type flateCompressor struct {
+	writers sync.Pool
+	readers sync.Pool
+}
+
+// NewFlateCompressor returns the Compressor in DEFLATE format of level,
+// see compress/flate.
+func NewFlateCompressor(level int) (Compressor, error) {
+	if _, err := flate.NewWriter(ioutil.Discard, level); err != nil {
+		return nil, err
+	}
+
+	c := &flateCompressor{}
+	c.writers.New = func() interface{} {
+		w, _ := flate.NewWriter(ioutil.Discard, level)
+		return w
+	}
+	c.readers.New = func() interface{} {
+		return flate.NewReader(bytes.NewReader(nil))
+	}
+	return c, nil
+}
+
+func (c *flateCompressor) Compress(dst, src []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	w := c.writers.Get().(*flate.Writer)
+	defer c.writers.Put(w)
+
+	w.Reset(buf)
+	if _, err := w.Write(src); err != nil {
+		return dst, err
+	}
+	if err := w.Close(); err != nil {
+		return dst, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *flateCompressor) Decompress(dst, src []byte, limit int) ([]byte, error) {
+	r := c.readers.Get().(io.ReadCloser)
+	defer c.readers.Put(r)
+
+	if err := r.(flate.Resetter).Reset(bytes.NewReader(src), nil); err != nil {
+		return dst, err
+	}
+	return readLimited(dst, r, limit)
+}
+
+// gzipCompressor compresses in gzip format, the writers and readers are
+// pooled.
+type gzipCompressor struct {
+	writers sync.Pool
+	readers sync.Pool
+}
+
+// NewGzipCompressor returns the Compressor in gzip format of level, see
+// compress/gzip.
+func NewGzipCompressor(level int) (Compressor, error) {
+	if _, err := gzip.NewWriterLevel(ioutil.Discard, level); err != nil {
+		return nil, err
+	}
+
+	c := &gzipCompressor{}
+	c.writers.New = func() interface{} {
+		w, _ := gzip.NewWriterLevel(ioutil.Discard, level)
+		return w
+	}
+	return c, nil
+}
+
+func (c *gzipCompressor) Compress(dst, src []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	w := c.writers.Get().(*gzip.Writer)
+	defer c.writers.Put(w)
+
+	w.Reset(buf)
+	if _, err := w.Write(src); err != nil {
+		return dst, err
+	}
+	if err := w.Close(); err != nil {
+		return dst, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *gzipCompressor) Decompress(dst, src []byte, limit int) ([]byte, error) {
+	var (
+		r   *gzip.Reader
+		err error
+	)
+	if v := c.readers.Get(); v != nil {
+		r = v.(*gzip.Reader)
+		err = r.Reset(bytes.NewReader(src))
+	} else {
+		r, err = gzip.NewReader(bytes.NewReader(src))
+	}
+	if err != nil {
+		return dst, err
+	}
+	defer c.readers.Put(r)
+
+	return readLimited(dst, r, limit)
+}
+
+// readLimited appends the data of r to dst, no more than limit bytes.
+func readLimited(dst []byte, r io.Reader, limit int) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	n, err := buf.ReadFrom(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return dst, err
+	}
+	if n > int64(limit) {
+		return dst, ErrMsgTooLarge
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,175 @@
+package session
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCompressors(t *testing.T) {
+	flateCompressor, _ := NewFlateCompressor(flate.BestSpeed)
+	gzipCompressor, _ := NewGzipCompressor(flate.DefaultCompression)
+	if _, err := NewFlateCompressor(100); err == nil {
+		t.Fatal("invalid level accepted")
+	}
+
+	data := bytes.Repeat([]byte("state sync "), 100)
+	for _, c := range []Compressor{flateCompressor, gzipCompressor} {
+		for i := 0; i < 2; i++ {
+			b, err := c.Compress(nil, data)
+			if err != nil || len(b) >= len(data) {
+				t.Fatalf("%T: compress %d bytes to %d, %v", c, len(data), len(b), err)
+			}
+
+			d, err := c.Decompress([]byte("prefix"), b, len(data))
+			if err != nil || !bytes.Equal(d, append([]byte("prefix"), data...)) {
+				t.Fatalf("%T: decompress %q, %v", c, d, err)
+			}
+			if _, err := c.Decompress(nil, b, len(data)-1); err != ErrMsgTooLarge {
+				t.Fatalf("%T: decompress exceeding limit, %v", c, err)
+			}
+		}
+	}
+}
+
+func TestCompressionSession(t *testing.T) {
+	listener, err := ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	compressor, _ := NewGzipCompressor(flate.DefaultCompression)
+	tooLarge := make(chan struct{}, 1)
+	go func() {
+		srvSession, err := listener.AcceptTCP()
+		if err != nil {
+			return
+		}
+		srvSession.SetCodecs(&tcpCodecs{})
+		srvSession.SetCompression(compressor, 64)
+		srvSession.SetMaxMessage(4096)
+		srvSession.Start(func(s Session, e Event) {
+			switch e.Type() {
+			case EventType_Message:
+				msg := e.Message().(*stringMsg)
+				s.Send(&stringMsg{msg: append([]byte(nil), msg.msg...)})
+			case EventType_Error:
+				if errors.Is(e.Error(), ErrMsgTooLarge) {
+					tooLarge <- struct{}{}
+				}
+			}
+		})
+	}()
+
+	cliSession, err := ConnectTCP("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	defer cliSession.Close()
+
+	received := make(chan []byte, 10)
+	cliSession.SetCodecs(&tcpCodecs{})
+	cliSession.SetCompression(compressor, 64)
+	cliSession.SetMaxMessage(1 << 21)
+	cliSession.Start(func(s Session, e Event) {
+		switch e.Type() {
+		case EventType_Message:
+			received <- append([]byte(nil), e.Message().(*stringMsg).msg...)
+		case EventType_Error:
+			t.Errorf("client error, %s", e.Error())
+		}
+	})
+
+	// the compression of peer advertised before the reply.
+	cliSession.Send(&stringMsg{msg: []byte("short")})
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait message timeout")
+	}
+
+	// the decompressed size of the last message exceeds the max message size.
+	msgs := [][]byte{
+		bytes.Repeat([]byte("compressible "), 300),
+		make([]byte, 1<<20),
+	}
+	for _, msg := range msgs {
+		cliSession.Send(&stringMsg{msg: msg})
+	}
+	for _, msg := range msgs[:1] {
+		select {
+		case b := <-received:
+			if !bytes.Equal(b, msg) {
+				t.Fatalf("receive msg len %d, expected %d", len(b), len(msg))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("wait message timeout")
+		}
+	}
+	select {
+	case <-tooLarge:
+	case <-time.After(5 * time.Second):
+		t.Fatal("decompression not limited")
+	}
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+	listener, err := ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	// the server without Compressor.
+	go func() {
+		srvSession, err := listener.AcceptTCP()
+		if err != nil {
+			return
+		}
+		srvSession.SetCodecs(&tcpCodecs{})
+		srvSession.Start(func(s Session, e Event) {
+			switch e.Type() {
+			case EventType_Message:
+				msg := e.Message().(*stringMsg)
+				s.Send(&stringMsg{msg: append([]byte(nil), msg.msg...)})
+			case EventType_Error:
+				t.Errorf("server error, %s", e.Error())
+			}
+		})
+	}()
+
+	cliSession, err := ConnectTCP("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	defer cliSession.Close()
+
+	compressor, _ := NewFlateCompressor(flate.DefaultCompression)
+	received := make(chan []byte, 10)
+	cliSession.SetCodecs(&tcpCodecs{})
+	cliSession.SetCompression(compressor, 0)
+	cliSession.Start(func(s Session, e Event) {
+		if e.Type() == EventType_Message {
+			received <- append([]byte(nil), e.Message().(*stringMsg).msg...)
+		}
+	})
+
+	msg := bytes.Repeat([]byte("compressible "), 300)
+	for i := 0; i < 3; i++ {
+		cliSession.Send(&stringMsg{msg: msg})
+		select {
+		case b := <-received:
+			if !bytes.Equal(b, msg) {
+				t.Fatalf("receive msg len %d, expected %d", len(b), len(msg))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("wait message timeout")
+		}
+	}
+	if st := cliSession.Stats(); st.BytesSent < uint64(3*len(msg)) {
+		t.Fatalf("message compressed without negotiation, %d bytes sent", st.BytesSent)
+	}
+}
@@ -10,19 +10,57 @@ import (
 )
 
 var (
-	ErrUnknownNetwork = errors.New("unknown network")
+	ErrUnknownNetwork  = errors.New("unknown network")
+	ErrListenerClosed  = errors.New("listener closed")
+	ErrConnClosed      = errors.New("connection closed")
+	ErrServerClosed    = errors.New("server closed")
+	ErrReconnecting    = errors.New("session reconnecting")
+	ErrReconnectPolicy = errors.New("reconnect policy error")
+	ErrSendBufferFull  = errors.New("send buffer full")
+	ErrSendQueueFull   = errors.New("send queue full")
 
 	// Define errors that occur while calling session method.
 	ErrNilEventCallback  = errors.New("nil event callback")
 	ErrSessionNotStarted = errors.New("session not started")
 	ErrSessionStarted    = errors.New("session started")
 	ErrSessionClosed     = errors.New("session closed")
+	ErrSessionClosing    = errors.New("session closing")
+	ErrCloseTimeout      = errors.New("graceful close timeout")
 	ErrNilCodecs         = errors.New("nil codecs")
 	ErrBuffSize          = errors.New("buffer size error")
 	ErrMaxMsgSize        = errors.New("max message size error")
 	ErrSendQueueSize     = errors.New("send queue size error")
+	ErrOverflowPolicy    = errors.New("overflow policy error")
+	ErrQueueType         = errors.New("invalid send queue type")
+	ErrFlushDelay        = errors.New("flush delay error")
+	ErrPriority          = errors.New("invalid priority")
 	ErrNilMessage        = errors.New("nil message")
 	ErrMsgTooLarge       = errors.New("message too large")
+	ErrNilTLSConfig      = errors.New("nil tls config")
+	ErrFilesNotSupported = errors.New("files passing not supported")
+	ErrFilesNotAccepted  = errors.New("files received but not accepted by codecs")
+	ErrTooManyFiles      = errors.New("too many files")
+	ErrNotStreamSession  = errors.New("not stream session")
+
+	ErrWebSocketHandshake = errors.New("websocket handshake failed")
+	ErrWebSocketProtocol  = errors.New("websocket protocol error")
+
+	ErrHeartbeatConfig    = errors.New("heartbeat config error")
+	ErrControlFrame       = errors.New("invalid control frame")
+	ErrNilFramer          = errors.New("nil framer")
+	ErrFramerConfig       = errors.New("framer config error")
+	ErrFrameFlags         = errors.New("frame flags not supported")
+	ErrFrameHeader        = errors.New("invalid frame header")
+	ErrDelimiterInMessage = errors.New("delimiter in message")
+	ErrCompressConfig     = errors.New("compression config error")
+	ErrCompressedFrame    = errors.New("compressed frame not supported")
+	ErrCipherConfig       = errors.New("cipher config error")
+	ErrAuthFailed         = errors.New("message authentication failed")
+	ErrNonceExhausted     = errors.New("nonce exhausted")
+	ErrHandshakeConfig    = errors.New("handshake config error")
+
+	ErrARQConfig       = errors.New("arq config error")
+	ErrPeerUnreachable = errors.New("peer unreachable")
 )
 
 type ErrorType int8
@@ -30,12 +68,22 @@ type ErrorType int8
 const (
 	ErrorType_SendMessage    = ErrorType(1)
 	ErrorType_ReceiveMessage = ErrorType(2)
+	ErrorType_Handshake      = ErrorType(3)
+	ErrorType_RPC            = ErrorType(4)
+	ErrorType_Handler        = ErrorType(5)
+	ErrorType_Auth           = ErrorType(6)
+	ErrorType_QueueOverflow  = ErrorType(7)
 )
 
 var (
 	errorTypeStrings = [...]string{
 		ErrorType_SendMessage:    "SendMessageError",
 		ErrorType_ReceiveMessage: "ReceiveMessageError",
+		ErrorType_Handshake:      "HandshakeError",
+		ErrorType_RPC:            "RPCError",
+		ErrorType_Handler:        "HandlerError",
+		ErrorType_Auth:           "AuthError",
+		ErrorType_QueueOverflow:  "QueueOverflowError",
 	}
 )
 
@@ -53,6 +101,9 @@ func (e *Error) Error() string {
 	return fmt.Sprintf("%s: %s", e.errType.String(), e.err.Error())
 }
 
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error { return e.err }
+
 func newError(t ErrorType, e error) *Error {
 	if e == nil {
 		panic("nil internal error")
@@ -60,6 +111,15 @@ func newError(t ErrorType, e error) *Error {
 	return &Error{errType: t, err: e}
 }
 
+// timeoutError is returned by the virtual connections when deadline exceeded.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var errTimeout error = timeoutError{}
+
 type timeout interface {
 	Timeout() bool
 }
@@ -6,14 +6,28 @@ const (
 	// message arrival.
 	EventType_Message = EventType(1)
 	// error occur.
-	EventType_Error   = EventType(2)
+	EventType_Error = EventType(2)
 	// session close.
-	EventType_Close   = EventType(3)
+	EventType_Close = EventType(3)
+	// reconnecting after connection lost.
+	EventType_Reconnecting = EventType(4)
+	// reconnected.
+	EventType_Reconnected = EventType(5)
 )
 
+// Reasons reported by EventType_Close events.
 const (
-	close_ConnReset = "connection reset"
-	close_RemoteClose = "remote session closed"
+	CloseReason_ConnReset          = "connection reset"
+	CloseReason_RemoteClose        = "remote session closed"
+	CloseReason_HandshakeFailed    = "handshake failed"
+	CloseReason_ListenerClosed     = "listener closed"
+	CloseReason_ProtocolError      = "protocol error"
+	CloseReason_PeerUnreachable    = "peer unreachable"
+	CloseReason_LocalGracefulClose = "local graceful close"
+	CloseReason_IdleTimeout        = "idle timeout"
+	CloseReason_HeartbeatTimeout   = "heartbeat timeout"
+	CloseReason_AuthFailed         = "authentication failed"
+	CloseReason_QueueOverflow      = "send queue overflow"
 )
 
 // Event represent events that occur during session communication.
@@ -45,6 +59,14 @@ func (e *Event) Reason() string {
 	return ""
 }
 
+// Attempt returns the number of reconnection attempt, starting from 1.
+func (e *Event) Attempt() int {
+	if e.evtType == EventType_Reconnecting || e.evtType == EventType_Reconnected {
+		return e.o.(int)
+	}
+	return 0
+}
+
 func newEventMessage(msg interface{}) Event {
 	if msg == nil {
 		panic(ErrNilMessage)
@@ -60,8 +82,20 @@ func newEventError(err *Error) Event {
 	return Event{evtType: EventType_Error, o: err}
 }
 
+// NewErrorEvent returns an EventType_Error event, it's used by the layers
+// built on session to report errors through EventCallback.
+func NewErrorEvent(t ErrorType, err error) Event {
+	return newEventError(newError(t, err))
+}
+
 func newEventClose(s string) Event {
 	return Event{evtType: EventType_Close, o: s}
 }
 
+func newEventReconnecting(attempt int) Event {
+	return Event{evtType: EventType_Reconnecting, o: attempt}
+}
 
+func newEventReconnected(attempt int) Event {
+	return Event{evtType: EventType_Reconnected, o: attempt}
+}
@@ -0,0 +1,393 @@
+package session
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// FrameFlags are the flags carried by frame header.
+type FrameFlags uint8
+
+const (
+	// control frame handled by session itself, e.g., heartbeat.
+	FrameControl = FrameFlags(1 << 0)
+
+	// message data compressed by Compressor.
+	FrameCompressed = FrameFlags(1 << 1)
+)
+
+// FrameHeader is the header decoded by Framer.
+type FrameHeader struct {
+	HeaderLen  int        // 头部长度，跳过不交给编解码器
+	Size       int        // 头部之后交给编解码器的数据长度
+	TrailerLen int        // 数据之后跳过的尾部长度
+	Flags      FrameFlags // 标志位
+}
+
+// Framer delimits the messages in the byte stream of stream sessions.
+type Framer interface {
+	// The max length of header written before message data.
+	HeaderLen() int
+
+	// The flags can be carried by header.
+	Flags() FrameFlags
+
+	// Encode the header of message data into hdr, returns the length of
+	// header. The header may be embedded in message data.
+	EncodeHeader(hdr []byte, data []byte, flags FrameFlags) (int, error)
+
+	// Decode the header at the beginning of b, returns false if more bytes
+	// required.
+	DecodeHeader(b []byte) (FrameHeader, bool, error)
+}
+
+// TrailerFramer is implemented by the Framer writing a trailer after each
+// message, e.g., the delimiter. The receive buffer of session is enlarged
+// to hold the max message along with trailer, for the Framer may not find
+// the end of message until the trailer received.
+type TrailerFramer interface {
+	Framer
+
+	// The trailer written after message data.
+	Trailer() []byte
+}
+
+// maxSizeOf returns the max size of message data can be framed by f.
+func maxSizeOf(f Framer) int {
+	switch f := f.(type) {
+	case *lengthFramer:
+		return f.maxSize()
+	case *offsetFramer:
+		return f.maxSize()
+	default:
+		return TCPMaxMsgSize
+	}
+}
+
+// trailerOf returns the trailer of Framer, nil if it writes no trailer.
+func trailerOf(f Framer) []byte {
+	if tf, ok := f.(TrailerFramer); ok {
+		return tf.Trailer()
+	}
+	return nil
+}
+
+// DefaultFramer precedes each message with TCPMsgSizeLen bytes of big-endian
+// size, the highest 2 bits of which flag the control and compressed frames.
+// So the max size of message framed is 2^30-1 bytes, and the peers framing
+// the size in all 31 bits, i.e., the versions before flags introduced, must
+// not send larger messages, whose size would be read as flags.
+var DefaultFramer Framer = newLengthFramer(TCPMsgSizeLen, binary.BigEndian, false, 2)
+
+// RawFramer bypasses the framing, e.g., for proxies and file transfer. Each
+// chunk of bytes read, no longer than the max message size, is passed to
+// Codecs, and the message data is written verbatim.
+var RawFramer Framer = rawFramer{}
+
+// lengthFramer precedes message data with a length field, the highest
+// flagBits bits of which carry flags, from the highest bit in order of flags.
+type lengthFramer struct {
+	lengthSize    int
+	order         binary.ByteOrder
+	includeHeader bool
+	flagBits      uint
+	maxLength     uint64
+}
+
+// NewLengthFramer returns the Framer preceding each message with the length
+// field of lengthSize (2, 4 or 8) bytes in order. If includeHeader, the
+// length counts the length field itself.
+func NewLengthFramer(lengthSize int, order binary.ByteOrder, includeHeader bool) Framer {
+	return newLengthFramer(lengthSize, order, includeHeader, 0)
+}
+
+func newLengthFramer(lengthSize int, order binary.ByteOrder, includeHeader bool, flagBits uint) *lengthFramer {
+	if lengthSize != 2 && lengthSize != 4 && lengthSize != 8 {
+		panic(ErrFramerConfig)
+	}
+	if order == nil {
+		panic(ErrFramerConfig)
+	}
+
+	maxLength := uint64(1)<<(uint(lengthSize)*8-flagBits) - 1
+	if maxLength > TCPMaxMsgSize {
+		maxLength = TCPMaxMsgSize
+	}
+	return &lengthFramer{
+		lengthSize:    lengthSize,
+		order:         order,
+		includeHeader: includeHeader,
+		flagBits:      flagBits,
+		maxLength:     maxLength,
+	}
+}
+
+// maxSize returns the max size of message data can be framed.
+func (f *lengthFramer) maxSize() int {
+	if f.includeHeader {
+		return int(f.maxLength) - f.lengthSize
+	}
+	return int(f.maxLength)
+}
+
+func (f *lengthFramer) HeaderLen() int { return f.lengthSize }
+
+func (f *lengthFramer) Flags() FrameFlags { return FrameFlags(1<<f.flagBits - 1) }
+
+func (f *lengthFramer) EncodeHeader(hdr []byte, data []byte, flags FrameFlags) (int, error) {
+	if flags&^f.Flags() != 0 {
+		return 0, ErrFrameFlags
+	}
+
+	length := uint64(len(data))
+	if f.includeHeader {
+		length += uint64(f.lengthSize)
+	}
+	if length > f.maxLength {
+		return 0, ErrMsgTooLarge
+	}
+
+	v := length
+	for i := uint(0); i < f.flagBits; i++ {
+		if flags&(1<<i) != 0 {
+			v |= 1 << (uint(f.lengthSize)*8 - 1 - i)
+		}
+	}
+	switch f.lengthSize {
+	case 2:
+		f.order.PutUint16(hdr, uint16(v))
+	case 4:
+		f.order.PutUint32(hdr, uint32(v))
+	default:
+		f.order.PutUint64(hdr, v)
+	}
+	return f.lengthSize, nil
+}
+
+func (f *lengthFramer) DecodeHeader(b []byte) (FrameHeader, bool, error) {
+	if len(b) < f.lengthSize {
+		return FrameHeader{}, false, nil
+	}
+
+	var v uint64
+	switch f.lengthSize {
+	case 2:
+		v = uint64(f.order.Uint16(b))
+	case 4:
+		v = uint64(f.order.Uint32(b))
+	default:
+		v = f.order.Uint64(b)
+	}
+
+	var flags FrameFlags
+	for i := uint(0); i < f.flagBits; i++ {
+		if v&(1<<(uint(f.lengthSize)*8-1-i)) != 0 {
+			flags |= 1 << i
+		}
+	}
+
+	length := v & (1<<(uint(f.lengthSize)*8-f.flagBits) - 1)
+	if f.includeHeader {
+		if length < uint64(f.lengthSize) {
+			return FrameHeader{}, false, ErrFrameHeader
+		}
+		length -= uint64(f.lengthSize)
+	}
+	if length > TCPMaxMsgSize {
+		return FrameHeader{}, false, ErrMsgTooLarge
+	}
+
+	return FrameHeader{
+		HeaderLen: f.lengthSize,
+		Size:      int(length),
+		Flags:     flags,
+	}, true, nil
+}
+
+// uvarintFramer precedes message data with the size in uvarint.
+type uvarintFramer struct{}
+
+// NewUvarintFramer returns the Framer preceding each message with its size
+// in uvarint.
+func NewUvarintFramer() Framer { return uvarintFramer{} }
+
+func (uvarintFramer) HeaderLen() int { return binary.MaxVarintLen64 }
+
+func (uvarintFramer) Flags() FrameFlags { return 0 }
+
+func (uvarintFramer) EncodeHeader(hdr []byte, data []byte, flags FrameFlags) (int, error) {
+	if flags != 0 {
+		return 0, ErrFrameFlags
+	}
+	if len(data) > TCPMaxMsgSize {
+		return 0, ErrMsgTooLarge
+	}
+	return binary.PutUvarint(hdr, uint64(len(data))), nil
+}
+
+func (uvarintFramer) DecodeHeader(b []byte) (FrameHeader, bool, error) {
+	size, n := binary.Uvarint(b)
+	switch {
+	case n == 0:
+		return FrameHeader{}, false, nil
+	case n < 0:
+		return FrameHeader{}, false, ErrFrameHeader
+	case size > TCPMaxMsgSize:
+		return FrameHeader{}, false, ErrMsgTooLarge
+	}
+	return FrameHeader{HeaderLen: n, Size: int(size)}, true, nil
+}
+
+// offsetFramer delimits the messages with a fixed header embedded in message
+// data, which contains a length field at offset.
+type offsetFramer struct {
+	headerLen     int
+	lengthOffset  int
+	length        *lengthFramer
+	includeHeader bool
+}
+
+// NewOffsetFramer returns the Framer of messages beginning with a fixed
+// header of headerLen bytes, e.g., containing message ID and flags, which is
+// encoded by Codecs. The length field of lengthSize (2, 4 or 8) bytes in
+// order at lengthOffset of header is filled in by session, it's the length
+// of data following header, or the whole message if includeHeader. The whole
+// message including header is passed to Codecs.
+func NewOffsetFramer(headerLen, lengthOffset, lengthSize int, order binary.ByteOrder, includeHeader bool) Framer {
+	if lengthOffset < 0 || lengthOffset+lengthSize > headerLen {
+		panic(ErrFramerConfig)
+	}
+	return &offsetFramer{
+		headerLen:     headerLen,
+		lengthOffset:  lengthOffset,
+		length:        newLengthFramer(lengthSize, order, false, 0),
+		includeHeader: includeHeader,
+	}
+}
+
+// maxSize returns the max size of message data including header can be
+// framed.
+func (f *offsetFramer) maxSize() int {
+	size := f.length.maxSize()
+	if f.includeHeader {
+		return size
+	}
+	if size > TCPMaxMsgSize-f.headerLen {
+		return TCPMaxMsgSize
+	}
+	return size + f.headerLen
+}
+
+func (f *offsetFramer) HeaderLen() int { return 0 }
+
+func (f *offsetFramer) Flags() FrameFlags { return 0 }
+
+func (f *offsetFramer) EncodeHeader(hdr []byte, data []byte, flags FrameFlags) (int, error) {
+	if flags != 0 {
+		return 0, ErrFrameFlags
+	}
+	if len(data) < f.headerLen {
+		return 0, ErrFrameHeader
+	}
+
+	length := len(data)
+	if !f.includeHeader {
+		length -= f.headerLen
+	}
+	if uint64(length) > f.length.maxLength {
+		return 0, ErrMsgTooLarge
+	}
+
+	switch f.length.lengthSize {
+	case 2:
+		f.length.order.PutUint16(data[f.lengthOffset:], uint16(length))
+	case 4:
+		f.length.order.PutUint32(data[f.lengthOffset:], uint32(length))
+	default:
+		f.length.order.PutUint64(data[f.lengthOffset:], uint64(length))
+	}
+	return 0, nil
+}
+
+func (f *offsetFramer) DecodeHeader(b []byte) (FrameHeader, bool, error) {
+	if len(b) < f.headerLen {
+		return FrameHeader{}, false, nil
+	}
+
+	h, _, err := f.length.DecodeHeader(b[f.lengthOffset:])
+	if err != nil {
+		return FrameHeader{}, false, err
+	}
+
+	size := h.Size
+	if f.includeHeader {
+		if size < f.headerLen {
+			return FrameHeader{}, false, ErrFrameHeader
+		}
+	} else if size > math.MaxInt32-f.headerLen {
+		return FrameHeader{}, false, ErrMsgTooLarge
+	} else {
+		size += f.headerLen
+	}
+	return FrameHeader{Size: size}, true, nil
+}
+
+// delimiterFramer splits the messages on delimiter.
+type delimiterFramer struct {
+	delim []byte
+}
+
+// NewDelimiterFramer returns the Framer splitting messages on delim, e.g.,
+// "\n" or "\r\n" for text lines. The delimiter is written after each
+// message and stripped from the message received. The messages containing
+// delimiter can not be sent, and the lines longer than the max message size
+// are discarded.
+func NewDelimiterFramer(delim []byte) Framer {
+	if len(delim) == 0 {
+		panic("empty delimiter")
+	}
+	return &delimiterFramer{delim: append([]byte(nil), delim...)}
+}
+
+func (f *delimiterFramer) HeaderLen() int { return 0 }
+
+func (f *delimiterFramer) Flags() FrameFlags { return 0 }
+
+func (f *delimiterFramer) Trailer() []byte { return f.delim }
+
+func (f *delimiterFramer) EncodeHeader(hdr []byte, data []byte, flags FrameFlags) (int, error) {
+	if flags != 0 {
+		return 0, ErrFrameFlags
+	}
+	if bytes.Contains(data, f.delim) {
+		return 0, ErrDelimiterInMessage
+	}
+	return 0, nil
+}
+
+func (f *delimiterFramer) DecodeHeader(b []byte) (FrameHeader, bool, error) {
+	i := bytes.Index(b, f.delim)
+	if i < 0 {
+		return FrameHeader{}, false, nil
+	}
+	return FrameHeader{Size: i, TrailerLen: len(f.delim)}, true, nil
+}
+
+// rawFramer treats the bytes buffered as a message.
+type rawFramer struct{}
+
+func (rawFramer) HeaderLen() int { return 0 }
+
+func (rawFramer) Flags() FrameFlags { return 0 }
+
+func (rawFramer) EncodeHeader(hdr []byte, data []byte, flags FrameFlags) (int, error) {
+	if flags != 0 {
+		return 0, ErrFrameFlags
+	}
+	return 0, nil
+}
+
+func (rawFramer) DecodeHeader(b []byte) (FrameHeader, bool, error) {
+	return FrameHeader{Size: len(b)}, true, nil
+}
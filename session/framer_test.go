@@ -0,0 +1,320 @@
+package session
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestFramers(t *testing.T) {
+	var (
+		data   = []byte("hello")
+		header = make([]byte, 16)
+	)
+
+	for _, c := range []struct {
+		name   string
+		framer Framer
+		header []byte
+	}{
+		{"u16be", NewLengthFramer(2, binary.BigEndian, false), []byte{0, 5}},
+		{"u16le", NewLengthFramer(2, binary.LittleEndian, false), []byte{5, 0}},
+		{"u32le", NewLengthFramer(4, binary.LittleEndian, false), []byte{5, 0, 0, 0}},
+		{"u32be+hdr", NewLengthFramer(4, binary.BigEndian, true), []byte{0, 0, 0, 9}},
+		{"u64be", NewLengthFramer(8, binary.BigEndian, false), []byte{0, 0, 0, 0, 0, 0, 0, 5}},
+		{"u64le+hdr", NewLengthFramer(8, binary.LittleEndian, true), []byte{13, 0, 0, 0, 0, 0, 0, 0}},
+		{"uvarint", NewUvarintFramer(), []byte{5}},
+		{"default", DefaultFramer, []byte{0, 0, 0, 5}},
+	} {
+		n, err := c.framer.EncodeHeader(header, data, 0)
+		if err != nil || !bytes.Equal(header[:n], c.header) {
+			t.Fatalf("%s: encode header %v, %v", c.name, header[:n], err)
+		}
+
+		if _, ok, _ := c.framer.DecodeHeader(c.header[:len(c.header)-1]); ok {
+			t.Fatalf("%s: decode partial header", c.name)
+		}
+		h, ok, err := c.framer.DecodeHeader(append(c.header, data...))
+		if !ok || err != nil || h.HeaderLen != len(c.header) || h.Size != len(data) || h.Flags != 0 {
+			t.Fatalf("%s: decode header %+v, %v, %v", c.name, h, ok, err)
+		}
+	}
+
+	// control flag.
+	n, _ := DefaultFramer.EncodeHeader(header, data, FrameControl)
+	if !bytes.Equal(header[:n], []byte{0x80, 0, 0, 5}) {
+		t.Fatalf("encode control header %v", header[:n])
+	}
+	if h, _, _ := DefaultFramer.DecodeHeader(header[:n]); h.Flags != FrameControl || h.Size != len(data) {
+		t.Fatalf("decode control header %+v", h)
+	}
+	if _, err := NewUvarintFramer().EncodeHeader(header, data, FrameControl); err != ErrFrameFlags {
+		t.Fatalf("encode unsupported flags, %v", err)
+	}
+
+	if _, err := NewLengthFramer(2, binary.BigEndian, false).EncodeHeader(header, make([]byte, 1<<16), 0); err != ErrMsgTooLarge {
+		t.Fatalf("encode too large message, %v", err)
+	}
+	if _, _, err := NewLengthFramer(2, binary.BigEndian, true).DecodeHeader([]byte{0, 1}); err != ErrFrameHeader {
+		t.Fatalf("decode invalid header, %v", err)
+	}
+
+	// header embedded in message: id(2) + length(2 le) + flags(1).
+	framer := NewOffsetFramer(5, 2, 2, binary.LittleEndian, false)
+	msg := []byte{0, 7, 0, 0, 1, 'h', 'i'}
+	if n, err := framer.EncodeHeader(header, msg, 0); n != 0 || err != nil || !bytes.Equal(msg[2:4], []byte{2, 0}) {
+		t.Fatalf("encode embedded header %v, %v", msg, err)
+	}
+	if h, ok, err := framer.DecodeHeader(msg); !ok || err != nil || h.HeaderLen != 0 || h.Size != len(msg) {
+		t.Fatalf("decode embedded header %+v, %v, %v", h, ok, err)
+	}
+	if _, err := framer.EncodeHeader(header, msg[:4], 0); err != ErrFrameHeader {
+		t.Fatalf("encode short message, %v", err)
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r != ErrFramerConfig {
+				t.Fatalf("length field out of header, %v", r)
+			}
+		}()
+		NewOffsetFramer(3, 2, 2, binary.LittleEndian, false)
+	}()
+}
+
+func TestFramerSession(t *testing.T) {
+	for _, framer := range []Framer{
+		NewLengthFramer(2, binary.LittleEndian, false),
+		NewUvarintFramer(),
+		NewOffsetFramer(4, 0, 4, binary.BigEndian, true),
+		NewDelimiterFramer([]byte("\r\n")),
+	} {
+		testFramerSession(t, framer)
+	}
+}
+
+func testFramerSession(t *testing.T, framer Framer) {
+	listener, err := ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	sizes := []int{4, 100, 1000, 20000}
+	go func() {
+		srvSession, err := listener.AcceptTCP()
+		if err != nil {
+			return
+		}
+		srvSession.SetCodecs(&tcpCodecs{})
+		srvSession.SetFramer(framer)
+		srvSession.Start(func(s Session, e Event) {
+			if e.Type() == EventType_Message {
+				msg := e.Message().(*stringMsg)
+				s.Send(&stringMsg{msg: append([]byte(nil), msg.msg...)})
+			}
+		})
+	}()
+
+	cliSession, err := ConnectTCP("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	defer cliSession.Close()
+
+	received := make(chan int, len(sizes))
+	cliSession.SetCodecs(&tcpCodecs{})
+	cliSession.SetFramer(framer)
+	cliSession.Start(func(s Session, e Event) {
+		switch e.Type() {
+		case EventType_Message:
+			received <- len(e.Message().(*stringMsg).msg)
+		case EventType_Error:
+			t.Errorf("%T: %s", framer, e.Error())
+		}
+	})
+
+	for _, size := range sizes {
+		cliSession.Send(&stringMsg{msg: make([]byte, size)})
+	}
+	for _, size := range sizes {
+		select {
+		case n := <-received:
+			if n != size {
+				t.Fatalf("%T: receive msg len %d, expected %d", framer, n, size)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%T: wait message timeout", framer)
+		}
+	}
+}
+
+func TestDelimiterFramer(t *testing.T) {
+	framer := NewDelimiterFramer([]byte("\r\n"))
+	if _, err := framer.EncodeHeader(nil, []byte("a\r\nb"), 0); err != ErrDelimiterInMessage {
+		t.Fatalf("encode message containing delimiter, %v", err)
+	}
+	if _, ok, _ := framer.DecodeHeader([]byte("hello\r")); ok {
+		t.Fatal("decode partial line")
+	}
+	if h, ok, err := framer.DecodeHeader([]byte("hello\r\nworld")); !ok || err != nil || h.Size != 5 || h.TrailerLen != 2 {
+		t.Fatalf("decode line %+v, %v, %v", h, ok, err)
+	}
+
+	listener, err := ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	var (
+		received = make(chan string, 10)
+		tooLarge = make(chan struct{}, 10)
+	)
+	go func() {
+		srvSession, err := listener.AcceptTCP()
+		if err != nil {
+			return
+		}
+		srvSession.SetCodecs(&tcpCodecs{})
+		srvSession.SetFramer(NewDelimiterFramer([]byte("\n")))
+		srvSession.SetMaxMessage(8)
+		srvSession.Start(func(s Session, e Event) {
+			switch e.Type() {
+			case EventType_Message:
+				received <- string(e.Message().(*stringMsg).msg)
+			case EventType_Error:
+				if errors.Is(e.Error(), ErrMsgTooLarge) {
+					tooLarge <- struct{}{}
+				}
+			}
+		})
+	}()
+
+	conn, err := net.Dial("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	defer conn.Close()
+
+	// the line longer than receive buffer is discarded in pieces.
+	longLine := bytes.Repeat([]byte{'x'}, 3*DefaultReceiveBuffSize)
+	var stream []byte
+	stream = append(stream, "foo\n\nbar\n"...)
+	stream = append(stream, "too long line\n"...)
+	stream = append(stream, longLine...)
+	stream = append(stream, "\nbaz\n"...)
+	conn.Write(stream)
+
+	for _, expected := range []string{"foo", "", "bar", "baz"} {
+		select {
+		case line := <-received:
+			if line != expected {
+				t.Fatalf("receive line %q, expected %q", line, expected)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("wait line %q timeout", expected)
+		}
+	}
+	if len(tooLarge) != 2 {
+		t.Fatalf("%d too large lines reported", len(tooLarge))
+	}
+}
+
+func TestRawFramer(t *testing.T) {
+	listener, err := ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		srvSession, err := listener.AcceptTCP()
+		if err != nil {
+			return
+		}
+		srvSession.SetCodecs(&tcpCodecs{})
+		srvSession.SetFramer(RawFramer)
+		srvSession.SetMaxMessage(16)
+		srvSession.Start(func(s Session, e Event) {
+			if e.Type() == EventType_Message {
+				msg := e.Message().(*stringMsg)
+				if len(msg.msg) > 16 {
+					t.Errorf("receive chunk len %d", len(msg.msg))
+				}
+				s.Send(&stringMsg{msg: append([]byte(nil), msg.msg...)})
+			}
+		})
+	}()
+
+	conn, err := net.Dial("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	defer conn.Close()
+
+	data := bytes.Repeat([]byte("raw bytes "), 100)
+	conn.Write(data)
+
+	echo := make([]byte, len(data))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(conn, echo); err != nil {
+		t.Fatalf("read echo failed, %s", err)
+	}
+	if !bytes.Equal(echo, data) {
+		t.Fatalf("echo %q", echo)
+	}
+}
+
+func TestFramerMaxMessage(t *testing.T) {
+	listener, err := ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	cliSession, err := ConnectTCP("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	defer cliSession.Close()
+
+	// the flags take the highest 2 bits of DefaultFramer.
+	if err := cliSession.SetMaxMessage(1 << 30); err != ErrMaxMsgSize {
+		t.Fatalf("set max message 1<<30, %v", err)
+	}
+	if err := cliSession.SetMaxMessage(1<<30 - 1); err != nil {
+		t.Fatalf("set max message 1<<30-1, %v", err)
+	}
+
+	// the header is not counted by the length field.
+	cliSession.SetFramer(NewOffsetFramer(5, 2, 2, binary.LittleEndian, false))
+	if err := cliSession.SetMaxMessage(100000); err != ErrMaxMsgSize {
+		t.Fatalf("set max message exceeding offset framer, %v", err)
+	}
+	if err := cliSession.SetMaxMessage(1<<16 - 1 + 5); err != nil {
+		t.Fatalf("set max message of offset framer, %v", err)
+	}
+
+	// lowered by the framer and cipher.
+	c, _ := NewAESGCMCipher(make([]byte, 16), true)
+	cliSession.SetFramer(NewLengthFramer(2, binary.BigEndian, false))
+	cliSession.SetCipher(c)
+	max := 1<<16 - 1 - c.Overhead()
+	if err := cliSession.SetMaxMessage(max + 1); err != ErrMaxMsgSize {
+		t.Fatalf("set max message exceeding framer, %v", err)
+	}
+
+	cliSession.SetCodecs(&tcpCodecs{})
+	cliSession.Start(func(s Session, e Event) {})
+	if err := cliSession.Send(&stringMsg{msg: make([]byte, max+1)}); err != ErrMsgTooLarge {
+		t.Fatalf("send message exceeding framer, %v", err)
+	}
+	if err := cliSession.Send(&stringMsg{msg: make([]byte, max)}); err != nil {
+		t.Fatalf("send max message, %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package session
+
+import (
+	"github.com/Godyy/go-net/io"
+	"time"
+)
+
+// Handshake is the framed access to the connection of stream session before
+// messages flow, see HandshakeFunc.
+type Handshake interface {
+	// The session in handshake.
+	Session() Session
+
+	// ReadFrame reads the data of next frame, which is valid until the next
+	// read.
+	ReadFrame() ([]byte, error)
+
+	// WriteFrame writes the data in a frame.
+	WriteFrame(data []byte) error
+
+	// SetCipher sets the Cipher of messages after handshake, e.g., with the
+	// key agreed. The handshake fails with ErrCipherConfig if the Framer can
+	// not carry encrypted messages.
+	SetCipher(c Cipher)
+}
+
+// HandshakeFunc authenticates the peer before messages flow, e.g., version
+// check, token exchange and key agreement. The frames are delimited by
+// Framer, but neither compressed nor encrypted. If it fails, the session is
+// closed with reason CloseReason_HandshakeFailed, or the reason of
+// RejectError.
+type HandshakeFunc func(h Handshake) error
+
+// RejectError rejects the peer in handshake.
+type RejectError struct {
+	Reason string // 拒绝原因，作为关闭原因
+}
+
+// Reject returns the RejectError of reason.
+func Reject(reason string) error { return &RejectError{Reason: reason} }
+
+func (e *RejectError) Error() string { return "handshake rejected: " + e.Reason }
+
+// SetHandshake sets the handshake hook of session, before session started.
+// The hook runs after connected and before messages flow, zero timeout means
+// no timeout.
+func (ss *streamSession) SetHandshake(fn HandshakeFunc, timeout time.Duration) error {
+	if timeout < 0 {
+		return ErrHandshakeConfig
+	}
+
+	ss.mtx.Lock()
+	defer ss.mtx.Unlock()
+
+	if ss.isStarted(false) {
+		return ErrSessionStarted
+	}
+	if ss.isClosed(false) {
+		return ErrSessionClosed
+	}
+
+	ss.handshakeFn = fn
+	ss.handshakeTimeout = timeout
+	return nil
+}
+
+// runHandshake runs the handshake hook if set.
+func (ss *streamSession) runHandshake() error {
+	if ss.handshakeFn == nil {
+		return nil
+	}
+
+	if ss.handshakeTimeout > 0 {
+		ss.conn.SetDeadline(time.Now().Add(ss.handshakeTimeout))
+		defer ss.conn.SetDeadline(time.Time{})
+	}
+
+	h := &handshake{
+		ss:      ss,
+		trailer: trailerOf(ss.framer),
+		buf:     io.NewBinaryBuffer(ss.receiveBufferSize(trailerOf(ss.framer))),
+		size:    -1,
+	}
+	if err := ss.handshakeFn(h); err != nil {
+		return err
+	}
+	if ss.cipher != nil && !cipherFramer(ss.framer) {
+		return ErrCipherConfig
+	}
+	ss.mtx.Lock()
+	ss.limitMaxMessage()
+	ss.mtx.Unlock()
+
+	// the data received beyond handshake is left to receiveThread.
+	if h.skip > 0 {
+		h.buf.Discard(h.skip)
+	}
+	if h.buf.Buffered() > 0 {
+		b, _ := h.buf.Peek(h.buf.Buffered())
+		ss.pending = append([]byte(nil), b...)
+	}
+	return nil
+}
+
+// handshake implements Handshake over the connection of stream session.
+type handshake struct {
+	ss      *streamSession
+	trailer []byte
+	buf     *io.Buffer
+	size    int // 上一帧数据长度
+	skip    int // 下次读取前跳过的长度
+}
+
+func (h *handshake) Session() Session { return h.ss.impl }
+
+func (h *handshake) SetCipher(c Cipher) { h.ss.cipher = c }
+
+func (h *handshake) ReadFrame() ([]byte, error) {
+	h.buf.Discard(h.skip)
+	h.skip = 0
+
+	for {
+		h.buf.Trim()
+
+		b, _ := h.buf.Peek(h.buf.Buffered())
+		hdr, ok, err := h.ss.framer.DecodeHeader(b)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			if hdr.Flags != 0 {
+				return nil, ErrFrameFlags
+			}
+			if hdr.Size > h.ss.maxMsgSize {
+				return nil, ErrMsgTooLarge
+			}
+			if n := hdr.HeaderLen + hdr.Size + hdr.TrailerLen; n > h.buf.Size() {
+				return nil, ErrMsgTooLarge
+			} else if n <= h.buf.Buffered() {
+				h.skip = n
+				return b[hdr.HeaderLen : hdr.HeaderLen+hdr.Size], nil
+			}
+		} else if h.buf.Available() == 0 {
+			return nil, ErrMsgTooLarge
+		}
+
+		if n, err := h.buf.ReadFrom(h.ss.conn); err != nil {
+			return nil, err
+		} else if n == 0 {
+			return nil, ErrConnClosed
+		}
+	}
+}
+
+func (h *handshake) WriteFrame(data []byte) error {
+	header := make([]byte, h.ss.framer.HeaderLen())
+	n, err := h.ss.framer.EncodeHeader(header, data, 0)
+	if err != nil {
+		return err
+	}
+
+	frame := make([]byte, 0, n+len(data)+len(h.trailer))
+	frame = append(frame, header[:n]...)
+	frame = append(frame, data...)
+	frame = append(frame, h.trailer...)
+	_, err = h.ss.conn.Write(frame)
+	return err
+}
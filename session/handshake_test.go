@@ -0,0 +1,240 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHandshake(t *testing.T) {
+	listener, err := ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	var (
+		key      = bytes.Repeat([]byte{9}, 16)
+		srvEvent = make(chan Event, 10)
+	)
+	srv, err := NewServer(SessionTemplate{
+		Codecs: &tcpCodecs{},
+		Handshake: func(h Handshake) error {
+			token, err := h.ReadFrame()
+			if err != nil {
+				return err
+			}
+			switch string(token) {
+			case "plain":
+			case "secure":
+				c, _ := NewAESGCMCipher(key, false)
+				h.SetCipher(c)
+			default:
+				h.WriteFrame([]byte("denied"))
+				return Reject("invalid token " + string(token))
+			}
+			return h.WriteFrame([]byte("welcome"))
+		},
+		HandshakeTimeout: 100 * time.Millisecond,
+	}, func(s Session, e Event) {
+		if e.Type() == EventType_Message {
+			msg := e.Message().(*stringMsg)
+			s.Send(&stringMsg{msg: append([]byte(nil), msg.msg...)})
+		}
+		srvEvent <- e
+	})
+	if err != nil {
+		t.Fatalf("create server failed, %s", err)
+	}
+	go srv.Serve(listener)
+	defer srv.Shutdown(context.Background())
+
+	// messages sent along with the handshake.
+	conn, err := net.Dial("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	conn.Write([]byte("\x00\x00\x00\x05plain\x00\x00\x00\x02hi"))
+	reply := make([]byte, 4+7+4+2)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("read reply failed, %s", err)
+	}
+	if string(reply) != "\x00\x00\x00\x07welcome\x00\x00\x00\x02hi" {
+		t.Fatalf("reply %q", reply)
+	}
+	conn.Close()
+
+	// encrypted after handshake.
+	cliSession, err := ConnectTCP("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	defer cliSession.Close()
+
+	received := make(chan string, 1)
+	cliSession.SetCodecs(&tcpCodecs{})
+	cliSession.SetHandshake(func(h Handshake) error {
+		if err := h.WriteFrame([]byte("secure")); err != nil {
+			return err
+		}
+		if b, err := h.ReadFrame(); err != nil || string(b) != "welcome" {
+			return errors.New("not welcome")
+		}
+		c, _ := NewAESGCMCipher(key, true)
+		h.SetCipher(c)
+		return nil
+	}, time.Second)
+	cliSession.Start(func(s Session, e Event) {
+		switch e.Type() {
+		case EventType_Message:
+			received <- string(e.Message().(*stringMsg).msg)
+		case EventType_Error, EventType_Close:
+			t.Errorf("client event %d", e.Type())
+		}
+	})
+	cliSession.Send(&stringMsg{msg: []byte("secret")})
+	select {
+	case msg := <-received:
+		if msg != "secret" {
+			t.Fatalf("receive %q", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait message timeout")
+	}
+	cliSession.Close()
+	drainEvents(srvEvent)
+
+	// rejected.
+	rejected, err := ConnectTCP("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	rejectReason := make(chan error, 1)
+	rejected.SetCodecs(&tcpCodecs{})
+	rejected.SetHandshake(func(h Handshake) error {
+		h.WriteFrame([]byte("guest"))
+		b, err := h.ReadFrame()
+		if err != nil {
+			return err
+		}
+		return Reject(string(b))
+	}, time.Second)
+	rejected.Start(func(s Session, e Event) {
+		if e.Type() == EventType_Close {
+			rejectReason <- errors.New(e.Reason())
+		}
+	})
+	if err := <-rejectReason; err.Error() != "denied" {
+		t.Fatalf("client close reason %s", err)
+	}
+	if e := waitEvent(t, srvEvent, EventType_Close); e.Reason() != "invalid token guest" {
+		t.Fatalf("server close reason %s", e.Reason())
+	}
+
+	// timeout.
+	conn, err = net.Dial("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	defer conn.Close()
+	if e := waitEvent(t, srvEvent, EventType_Error); e.Error().Type() != ErrorType_Handshake || !isTimeout(errors.Unwrap(e.Error())) {
+		t.Fatalf("server error %s", e.Error())
+	}
+	if e := waitEvent(t, srvEvent, EventType_Close); e.Reason() != CloseReason_HandshakeFailed {
+		t.Fatalf("server close reason %s", e.Reason())
+	}
+}
+
+func waitEvent(t *testing.T, ch chan Event, typ EventType) Event {
+	select {
+	case e := <-ch:
+		if e.Type() != typ {
+			t.Fatalf("event %d, expected %d", e.Type(), typ)
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatalf("wait event %d timeout", typ)
+	}
+	return Event{}
+}
+
+func drainEvents(ch chan Event) {
+	time.Sleep(50 * time.Millisecond)
+	for len(ch) > 0 {
+		<-ch
+	}
+}
+
+func TestHandshakeCipherMaxMessage(t *testing.T) {
+	listener, err := ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	var (
+		key    = bytes.Repeat([]byte{9}, 16)
+		framer = NewLengthFramer(2, binary.BigEndian, false)
+	)
+	setCipher := func(client bool) HandshakeFunc {
+		return func(h Handshake) error {
+			c, _ := NewAESGCMCipher(key, client)
+			h.SetCipher(c)
+			return nil
+		}
+	}
+
+	go func() {
+		srvSession, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		srvSession.SetCodecs(&tcpCodecs{})
+		srvSession.(*TCPSession).SetFramer(framer)
+		srvSession.(*TCPSession).SetHandshake(setCipher(false), time.Second)
+		srvSession.Start(func(s Session, e Event) {
+			if e.Type() == EventType_Message {
+				s.Send(e.Message())
+			}
+		})
+	}()
+
+	cliSession, err := ConnectTCP("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	defer cliSession.Close()
+
+	received := make(chan struct{}, 1)
+	cliSession.SetCodecs(&tcpCodecs{})
+	cliSession.SetFramer(framer)
+	cliSession.SetHandshake(setCipher(true), time.Second)
+	cliSession.Start(func(s Session, e Event) {
+		if e.Type() == EventType_Message {
+			received <- struct{}{}
+		}
+	})
+
+	// the echo received after handshake.
+	cliSession.Send(&stringMsg{msg: []byte("hi")})
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait message timeout")
+	}
+
+	c, _ := NewAESGCMCipher(key, true)
+	max := 1<<16 - 1 - c.Overhead()
+	if err := cliSession.Send(&stringMsg{msg: make([]byte, max+1)}); err != ErrMsgTooLarge {
+		t.Fatalf("send message exceeding cipher, %v", err)
+	}
+	if err := cliSession.Send(&stringMsg{msg: make([]byte, max)}); err != nil {
+		t.Fatalf("send max message, %v", err)
+	}
+}
@@ -0,0 +1,268 @@
+package session
+
+import (
+	"context"
+	"encoding/binary"
+	"sync/atomic"
+	"time"
+)
+
+// Control frames are transmitted along with messages by stream sessions,
+// flagged by FrameControl. They are handled by session itself and never
+// passed to Codecs.
+const (
+	controlPing     = 1
+	controlPong     = 2
+	controlCompress = 3 // 通告支持压缩
+
+	// type(1) + timestamp(8)
+	controlFrameLen = 9
+)
+
+// epoch is the base of monotonic timestamps.
+var epoch = time.Now()
+
+func monotime() int64 { return int64(time.Since(epoch)) }
+
+// controlMessage is a control frame to be sent.
+type controlMessage struct {
+	data [controlFrameLen]byte
+}
+
+func newControlMessage(typ byte, ts int64) *controlMessage {
+	m := &controlMessage{}
+	m.data[0] = typ
+	binary.BigEndian.PutUint64(m.data[1:], uint64(ts))
+	return m
+}
+
+func (m *controlMessage) Data() []byte { return m.data[:] }
+func (m *controlMessage) Length() int  { return controlFrameLen }
+func (m *controlMessage) Release()     {}
+
+// heartbeat is the state of heartbeat and idle detection. It is allocated
+// separately for the alignment of 64-bit atomic operations.
+type heartbeat struct {
+	lastActive  int64         // 最近收发消息的时间
+	lastPong    int64         // 最近收到响应的心跳时间戳
+	rtt         int64         // 往返时延
+	missed      int32         // 连续未响应的心跳数
+	maxMissed   int32         // 最大连续未响应的心跳数
+	interval    time.Duration // 心跳间隔
+	pongTimeout time.Duration // 心跳响应超时
+	idleTimeout time.Duration // 空闲超时
+}
+
+// SetHeartbeat enables the heartbeat, a ping is sent every interval and peer
+// replies pong immediately. If pong not received within pongTimeout for
+// maxMissed successive pings, the session is closed with reason
+// CloseReason_HeartbeatTimeout. Zero pongTimeout means interval, and zero
+// maxMissed means 1.
+func (ss *streamSession) SetHeartbeat(interval, pongTimeout time.Duration, maxMissed int) error {
+	if interval <= 0 || pongTimeout < 0 || maxMissed < 0 {
+		return ErrHeartbeatConfig
+	}
+	if pongTimeout == 0 {
+		pongTimeout = interval
+	}
+	if maxMissed == 0 {
+		maxMissed = 1
+	}
+
+	ss.mtx.Lock()
+	defer ss.mtx.Unlock()
+
+	if ss.isStarted(false) {
+		return ErrSessionStarted
+	}
+	if ss.isClosed(false) {
+		return ErrSessionClosed
+	}
+
+	ss.hb.interval = interval
+	ss.hb.pongTimeout = pongTimeout
+	ss.hb.maxMissed = int32(maxMissed)
+	return nil
+}
+
+// SetIdleTimeout closes the session with reason CloseReason_IdleTimeout if no
+// message sent or received for d. The control frames are not counted.
+func (ss *streamSession) SetIdleTimeout(d time.Duration) error {
+	if d <= 0 {
+		return ErrHeartbeatConfig
+	}
+
+	ss.mtx.Lock()
+	defer ss.mtx.Unlock()
+
+	if ss.isStarted(false) {
+		return ErrSessionStarted
+	}
+	if ss.isClosed(false) {
+		return ErrSessionClosed
+	}
+
+	ss.hb.idleTimeout = d
+	return nil
+}
+
+// RTT returns the round-trip time measured by the latest heartbeat, zero if
+// not measured yet.
+func (ss *streamSession) RTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&ss.hb.rtt))
+}
+
+func (ss *streamSession) Send(msg interface{}) error {
+	err := ss.session.Send(msg)
+	if err == nil {
+		ss.active()
+	}
+	return err
+}
+
+func (ss *streamSession) SendPriority(msg interface{}, prio Priority) error {
+	err := ss.session.SendPriority(msg, prio)
+	if err == nil {
+		ss.active()
+	}
+	return err
+}
+
+func (ss *streamSession) TrySend(msg interface{}) error {
+	err := ss.session.TrySend(msg)
+	if err == nil {
+		ss.active()
+	}
+	return err
+}
+
+func (ss *streamSession) SendContext(ctx context.Context, msg interface{}) error {
+	err := ss.session.SendContext(ctx, msg)
+	if err == nil {
+		ss.active()
+	}
+	return err
+}
+
+func (ss *streamSession) active() {
+	atomic.StoreInt64(&ss.hb.lastActive, monotime())
+}
+
+// keepalive sends pings, detects pong timeout and idle until session closed.
+func (ss *streamSession) keepalive() {
+	var (
+		hb        = ss.hb
+		pingC     <-chan time.Time
+		pongC     <-chan time.Time
+		idleC     <-chan time.Time
+		pongTimer *time.Timer
+		idleTimer *time.Timer
+		pings     []int64 // 等待响应的心跳时间戳
+	)
+
+	if hb.interval > 0 {
+		ticker := time.NewTicker(hb.interval)
+		defer ticker.Stop()
+		pingC = ticker.C
+		pongTimer = time.NewTimer(hb.pongTimeout)
+		pongTimer.Stop()
+		defer pongTimer.Stop()
+		pongC = pongTimer.C
+	}
+	if hb.idleTimeout > 0 {
+		idleTimer = time.NewTimer(hb.idleTimeout)
+		defer idleTimer.Stop()
+		idleC = idleTimer.C
+	}
+
+	for {
+		select {
+		case <-ss.closeCh:
+			return
+
+		case <-pingC:
+			ts := monotime()
+			ss.pushControl(newControlMessage(controlPing, ts))
+			if pings = append(pings, ts); len(pings) == 1 {
+				pongTimer.Reset(hb.pongTimeout)
+			}
+
+		case <-pongC:
+			now := monotime()
+			for len(pings) > 0 && time.Duration(now-pings[0]) >= hb.pongTimeout {
+				if atomic.LoadInt64(&hb.lastPong) < pings[0] &&
+					atomic.AddInt32(&hb.missed, 1) >= hb.maxMissed {
+					ss.closeWithEvent(CloseReason_HeartbeatTimeout)
+					return
+				}
+				pings = pings[1:]
+			}
+			if len(pings) > 0 {
+				pongTimer.Reset(hb.pongTimeout - time.Duration(now-pings[0]))
+			}
+
+		case <-idleC:
+			idle := time.Duration(monotime() - atomic.LoadInt64(&hb.lastActive))
+			if idle < hb.idleTimeout {
+				idleTimer.Reset(hb.idleTimeout - idle)
+				continue
+			}
+			ss.closeWithEvent(CloseReason_IdleTimeout)
+			return
+		}
+	}
+}
+
+// receiveControl decrypts and handles the control frame received. The data
+// is returned to BytesPool if pooled.
+func (ss *streamSession) receiveControl(data []byte, pooled bool) *Error {
+	if pooled {
+		defer BytesPool.Put(data)
+	}
+	if ss.cipher != nil {
+		b, err := ss.open(data)
+		if err != nil {
+			return newError(ErrorType_Auth, err)
+		}
+		defer BytesPool.Put(b)
+		data = b
+	}
+	if err := ss.handleControl(data); err != nil {
+		return newError(ErrorType_ReceiveMessage, err)
+	}
+	return nil
+}
+
+// handleControl handles the control frame received.
+func (ss *streamSession) handleControl(data []byte) error {
+	if len(data) != controlFrameLen {
+		return ErrControlFrame
+	}
+
+	ts := int64(binary.BigEndian.Uint64(data[1:]))
+	switch data[0] {
+	case controlPing:
+		ss.pushControl(newControlMessage(controlPong, ts))
+
+	case controlPong:
+		if ts > monotime() {
+			return ErrControlFrame
+		}
+		atomic.StoreInt64(&ss.hb.rtt, monotime()-ts)
+		atomic.StoreInt64(&ss.hb.lastPong, ts)
+		atomic.StoreInt32(&ss.hb.missed, 0)
+
+	case controlCompress:
+		atomic.StoreInt32(&ss.peerCompress, 1)
+
+	default:
+		return ErrControlFrame
+	}
+	return nil
+}
+
+// pushControl queues the control frame unless the send queue is full, the
+// receiving must not be blocked by sending.
+func (ss *streamSession) pushControl(m *controlMessage) {
+	ss.sendQueue.TryPush(m, priorityLevel(Priority_High))
+}
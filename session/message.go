@@ -2,8 +2,14 @@ package session
 
 import (
 	"errors"
+	"github.com/Godyy/go-net/io"
+	"os"
 )
 
+// BytesPool is the pool of message data, in size classes up to
+// TCPMaxMsgSize.
+var BytesPool = io.NewBytesPool(64, TCPMaxMsgSize)
+
 // Message is a capsulation for every single message coded sent by user.
 type Message interface {
 	// The data that user message be coded to.
@@ -17,7 +23,8 @@ type Message interface {
 }
 
 type message struct {
-	data []byte
+	data   []byte
+	pooled bool
 }
 
 func NewMessage(data []byte) *message {
@@ -36,4 +43,54 @@ func (p *message) Length() int {
 }
 
 func (p *message) Release() {
+	if p.pooled && p.data != nil {
+		BytesPool.Put(p.data)
+		p.data = nil
+	}
+}
+
+// NewPooledMessage returns the message of size bytes data allocated from
+// BytesPool, which is returned to pool on release, and must not be used after
+// that. The message sent is released by session after written.
+func NewPooledMessage(size int) *message {
+	return &message{data: BytesPool.Get(size), pooled: true}
+}
+
+// FileMessage is a Message carrying files. The descriptors of the files are
+// passed to peer along with the message data over "unixpacket" sessions.
+// The ownership of the files transfers to session on Send, they are closed
+// on release, i.e., after written or dropped, and must not be used after Send.
+type FileMessage interface {
+	Message
+
+	// The files attached to message.
+	Files() []*os.File
+}
+
+type fileMessage struct {
+	message
+	files []*os.File
+}
+
+func NewFileMessage(data []byte, files ...*os.File) *fileMessage {
+	if data == nil {
+		panic(errors.New("nil data"))
+	}
+	return &fileMessage{message: message{data: data}, files: files}
+}
+
+func (p *fileMessage) Files() []*os.File {
+	return p.files
+}
+
+func (p *fileMessage) Release() {
+	p.message.Release()
+	closeFiles(p.files)
+	p.files = nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
 }
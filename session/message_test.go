@@ -0,0 +1,92 @@
+package session
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestPooledMessage(t *testing.T) {
+	stats := BytesPool.Stats()
+	msg := NewPooledMessage(100)
+	if msg.Length() != 100 || cap(msg.Data()) != 128 {
+		t.Fatalf("pooled message of len %d, cap %d", msg.Length(), cap(msg.Data()))
+	}
+	msg.Release()
+	msg.Release()
+	if msg.Data() != nil {
+		t.Fatal("data not cleared after release")
+	}
+	if s := BytesPool.Stats(); s.Gets-stats.Gets < 1 || s.Puts-stats.Puts < 1 {
+		t.Fatalf("pool stats %+v, before %+v", s, stats)
+	}
+
+	// not pooled.
+	BytesPool.Put(make([]byte, 100))
+	if s := BytesPool.Stats(); s.Discarded-stats.Discarded < 1 {
+		t.Fatalf("pool stats %+v, before %+v", s, stats)
+	}
+}
+
+// pooledCodecs retains the pooled data in messages.
+type pooledCodecs struct {
+	tcpCodecs
+}
+
+type pooledMsg struct {
+	data []byte
+}
+
+func (c *pooledCodecs) DecodePooled(b []byte) (interface{}, error) {
+	return &pooledMsg{data: b}, nil
+}
+
+func TestPooledCodecs(t *testing.T) {
+	listener, err := ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	received := make(chan []byte, 10)
+	go func() {
+		srvSession, err := listener.AcceptTCP()
+		if err != nil {
+			return
+		}
+		srvSession.SetCodecs(&pooledCodecs{})
+		srvSession.SetReceiveBuffer(64)
+		srvSession.Start(func(s Session, e Event) {
+			if e.Type() == EventType_Message {
+				received <- e.Message().(*pooledMsg).data
+			}
+		})
+	}()
+
+	cliSession, err := ConnectTCP("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	defer cliSession.Close()
+
+	cliSession.SetCodecs(&tcpCodecs{})
+	cliSession.Start(func(s Session, e Event) {})
+
+	// the small messages referenced in receive buffer are copied to pooled
+	// data, and the large ones read into pooled data directly.
+	msgs := [][]byte{[]byte("small"), bytes.Repeat([]byte("large"), 1000), []byte("again")}
+	for _, msg := range msgs {
+		cliSession.Send(&stringMsg{msg: msg})
+	}
+	for _, msg := range msgs {
+		select {
+		case b := <-received:
+			if !bytes.Equal(b, msg) {
+				t.Fatalf("receive %q, expected %q", b, msg)
+			}
+			BytesPool.Put(b)
+		case <-time.After(5 * time.Second):
+			t.Fatal("wait message timeout")
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package session
+
+import (
+	"net"
+	"os"
+	"time"
+)
+
+// packetSession implements the message transmission over message-oriented
+// connections. Every message is transmitted as a single packet without any
+// length prefix, i.e., each Read returns one message and each Write sends
+// one message.
+type packetSession struct {
+	session
+}
+
+func newPacketSession(impl sessionImpl, conn net.Conn, maxMsgSize int) packetSession {
+	return packetSession{session: newSession(impl, conn, maxMsgSize)}
+}
+
+func (ps *packetSession) sendThread() {
+	for !ps.isClosed(true) {
+		// no more messages after closing, don't wait.
+		closing := ps.isClosing(true)
+		msg := ps.popMessage(!closing)
+		if msg == nil {
+			if closing && ps.sendPending() == 0 {
+				// all messages sent, shut down writing.
+				ps.closeWrite()
+				return
+			}
+			continue
+		}
+
+		/* 发送数据包 */
+		if ps.sendTimeout > 0 {
+			ps.conn.SetWriteDeadline(time.Now().Add(ps.sendTimeout))
+		}
+
+		err := ps.writePacket(msg)
+		if err == nil {
+			ps.count(counterBytesSent, msg.Length())
+			ps.sent(msg)
+		}
+		msg.Release()
+		if err != nil {
+			// if session had been closed, directly return.
+			if ps.isClosed(true) {
+				return
+			}
+
+			ps.countError(err)
+			evt := newEventError(newError(ErrorType_SendMessage, err))
+			ps.notifyEvent(evt)
+
+			if !isTimeout(err) {
+				time.Sleep(100 * time.Millisecond)
+			}
+		}
+	}
+}
+
+func (ps *packetSession) receiveThread() {
+	// one more byte to detect size-exceed packet, which will be truncated.
+	var receiveBuffer = make([]byte, ps.maxMsgSize+1)
+
+	for !ps.isClosed(true) {
+		/* 接收数据包 */
+		if ps.receiveTimeout > 0 {
+			ps.conn.SetReadDeadline(time.Now().Add(ps.receiveTimeout))
+		}
+
+		n, files, err := ps.readPacket(receiveBuffer)
+		if err != nil {
+			// if session had been closed, directly return.
+			if ps.isClosed(true) {
+				return
+			}
+
+			switch {
+			case isEOF(err):
+				// remote close session, local close too.
+				ps.closeWithEvent(CloseReason_RemoteClose)
+				return
+
+			case err == ErrListenerClosed:
+				// listener which the session belongs to had been closed.
+				ps.Close()
+				ps.notifyEvent(newEventClose(CloseReason_ListenerClosed))
+				return
+
+			case err == ErrPeerUnreachable:
+				// reliable transmission failed.
+				ps.Close()
+				ps.notifyEvent(newEventClose(CloseReason_PeerUnreachable))
+				return
+
+			default:
+				ps.countError(err)
+				ps.notifyEvent(newEventError(newError(ErrorType_ReceiveMessage, err)))
+
+				if !isTimeout(err) {
+					// other error, sleep a few time.
+					time.Sleep(100 * time.Millisecond)
+				}
+				continue
+			}
+		}
+
+		ps.count(counterBytesReceived, n)
+		if n > ps.maxMsgSize {
+			// receive a size-exceed packet, notify event and discard it.
+			ps.count(counterOversized, 1)
+			closeFiles(files)
+			ps.notifyEvent(newEventError(newError(ErrorType_ReceiveMessage, ErrMsgTooLarge)))
+			continue
+		}
+
+		// decode message.
+		if msg, err := ps.decode(receiveBuffer[:n], files); err != nil {
+			ps.count(counterDecodeErrors, 1)
+			ps.notifyEvent(newEventError(newError(ErrorType_ReceiveMessage, err)))
+		} else {
+			ps.count(counterMessagesReceived, 1)
+			ps.notifyEvent(newEventMessage(msg))
+		}
+	}
+}
+
+// decode the packet data and the files attached.
+func (ps *packetSession) decode(data []byte, files []*os.File) (interface{}, error) {
+	if len(files) == 0 {
+		return ps.codecs.Decode(data)
+	}
+
+	if fc, ok := ps.codecs.(FileCodecs); ok {
+		return fc.DecodeFiles(data, files)
+	}
+
+	// codecs does not accept files, close them.
+	closeFiles(files)
+	ps.notifyEvent(newEventError(newError(ErrorType_ReceiveMessage, ErrFilesNotAccepted)))
+	return ps.codecs.Decode(data)
+}
+
+// readPacket reads a packet and the files attached if the connection
+// supports file passing.
+func (ps *packetSession) readPacket(b []byte) (n int, files []*os.File, err error) {
+	if uc, ok := ps.conn.(*net.UnixConn); ok {
+		return readUnixPacket(uc, b)
+	}
+
+	n, err = ps.conn.Read(b)
+	return
+}
+
+// writePacket writes the message data as a packet, along with the attached
+// files if the message has.
+func (ps *packetSession) writePacket(msg Message) (err error) {
+	if fm, ok := msg.(FileMessage); ok && len(fm.Files()) > 0 {
+		if uc, ok := ps.conn.(*net.UnixConn); ok {
+			return writeUnixPacket(uc, msg.Data(), fm.Files())
+		}
+		return ErrFilesNotSupported
+	}
+
+	_, err = ps.conn.Write(msg.Data())
+	return
+}
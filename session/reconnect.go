@@ -0,0 +1,529 @@
+package session
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultReconnectMinBackoff = 100 * time.Millisecond
+	DefaultReconnectMaxBackoff = 30 * time.Second
+	DefaultReconnectMultiplier = 2
+)
+
+// ReconnectPolicy defines when and how to reconnect.
+type ReconnectPolicy struct {
+	MinBackoff     time.Duration // 首次重连前等待时长
+	MaxBackoff     time.Duration // 重连前最大等待时长
+	Multiplier     float64       // 每次重连等待时长增长倍数
+	Jitter         float64       // 等待时长随机浮动比例，[0, 1]
+	MaxAttempts    int           // 最大连续重连次数，0表示不限
+	ConnectTimeout time.Duration // 连接超时
+	BufferSize     int           // 断线期间缓存的待发送消息数，0表示不缓存
+}
+
+// backoff returns the time to wait before the attempt.
+func (p *ReconnectPolicy) backoff(attempt int) time.Duration {
+	var (
+		min        = p.MinBackoff
+		max        = p.MaxBackoff
+		multiplier = p.Multiplier
+	)
+	if min <= 0 {
+		min = DefaultReconnectMinBackoff
+	}
+	if max <= 0 {
+		max = DefaultReconnectMaxBackoff
+	}
+	if multiplier < 1 {
+		multiplier = DefaultReconnectMultiplier
+	}
+
+	d := float64(min)
+	for i := 1; i < attempt && d < float64(max); i++ {
+		d *= multiplier
+	}
+	if d > float64(max) {
+		d = float64(max)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// reconnectable reports whether the session should reconnect after closed
+// for the reason.
+func reconnectable(reason string) bool {
+	return reason == CloseReason_ConnReset || reason == CloseReason_RemoteClose
+}
+
+// ReconnectSession is a client session which reconnects once the connection
+// reset or closed by remote. The settings are applied to every underlying
+// session connected. It notifies EventType_Reconnecting before each attempt
+// and EventType_Reconnected after connected, and EventType_Close only if it
+// gives up reconnecting. The Cipher is per connection, set it in the
+// handshake hook by Handshake.SetCipher.
+type ReconnectSession struct {
+	id        uint64
+	policy    ReconnectPolicy
+	dial      func(timeout time.Duration) (Session, error)
+	mtx       sync.Mutex
+	template  SessionTemplate
+	cur       Session       // 当前会话，断线期间为nil
+	replaying bool          // 正在重发缓存的消息
+	buffer    []interface{} // 断线期间缓存的消息
+	started   bool
+	closing   bool
+	closed    bool
+	closeCh   chan struct{}
+	evtCB     EventCallback
+}
+
+// ConnectTCPReconnect connects to the address and returns a session which
+// reconnects according to the policy.
+func ConnectTCPReconnect(network, addr string, policy ReconnectPolicy) (*ReconnectSession, error) {
+	return newReconnectSession(policy, func(timeout time.Duration) (Session, error) {
+		return ConnectTCPTimeout(network, addr, timeout)
+	})
+}
+
+func newReconnectSession(policy ReconnectPolicy, dial func(time.Duration) (Session, error)) (*ReconnectSession, error) {
+	if policy.Jitter < 0 || policy.Jitter > 1 {
+		return nil, ErrReconnectPolicy
+	}
+
+	s, err := dial(policy.ConnectTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReconnectSession{
+		id:      atomic.AddUint64(&sessionID, 1),
+		policy:  policy,
+		dial:    dial,
+		cur:     s,
+		closeCh: make(chan struct{}),
+	}, nil
+}
+
+func (r *ReconnectSession) ID() uint64 { return r.id }
+
+func (r *ReconnectSession) Start(evtCB EventCallback) error {
+	if evtCB == nil {
+		return ErrNilEventCallback
+	}
+
+	r.mtx.Lock()
+	if r.started {
+		r.mtx.Unlock()
+		return ErrSessionStarted
+	}
+	if r.closed {
+		r.mtx.Unlock()
+		return ErrSessionClosed
+	}
+	r.evtCB = evtCB
+	r.started = true
+	cur := r.cur
+	r.mtx.Unlock()
+
+	if err := cur.Start(r.onEvent); err != nil {
+		r.mtx.Lock()
+		r.started = false
+		r.mtx.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Close stops reconnecting and closes the current session. The messages
+// buffered are discarded.
+func (r *ReconnectSession) Close() error {
+	r.mtx.Lock()
+	if !r.started {
+		r.mtx.Unlock()
+		return ErrSessionNotStarted
+	}
+	if r.closed {
+		r.mtx.Unlock()
+		return ErrSessionClosed
+	}
+	r.closed = true
+	close(r.closeCh)
+	cur := r.cur
+	r.buffer = nil
+	r.mtx.Unlock()
+
+	if cur != nil {
+		cur.Close()
+	}
+	return nil
+}
+
+// CloseGracefully stops reconnecting and closes the current session
+// gracefully. If the connection is lost, it closes immediately.
+func (r *ReconnectSession) CloseGracefully(timeout time.Duration) error {
+	r.mtx.Lock()
+	if !r.started {
+		r.mtx.Unlock()
+		return ErrSessionNotStarted
+	}
+	if r.closed {
+		r.mtx.Unlock()
+		return ErrSessionClosed
+	}
+	if r.closing {
+		r.mtx.Unlock()
+		return ErrSessionClosing
+	}
+	cur := r.cur
+	if cur == nil {
+		r.closed = true
+		close(r.closeCh)
+		r.buffer = nil
+		r.mtx.Unlock()
+
+		r.notifyEvent(newEventClose(CloseReason_LocalGracefulClose))
+		return nil
+	}
+	r.closing = true
+	r.mtx.Unlock()
+
+	return cur.CloseGracefully(timeout)
+}
+
+// set applies the setting to the current session and records it.
+func (r *ReconnectSession) set(apply func(Session) error, record func(*SessionTemplate)) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.started {
+		return ErrSessionStarted
+	}
+	if r.closed {
+		return ErrSessionClosed
+	}
+
+	if err := apply(r.cur); err != nil {
+		return err
+	}
+	record(&r.template)
+	return nil
+}
+
+func (r *ReconnectSession) SetCodecs(c Codecs) error {
+	return r.set(func(s Session) error { return s.SetCodecs(c) },
+		func(t *SessionTemplate) { t.Codecs = c })
+}
+
+func (r *ReconnectSession) SetSendTimeout(d time.Duration) error {
+	return r.set(func(s Session) error { return s.SetSendTimeout(d) },
+		func(t *SessionTemplate) { t.SendTimeout = d })
+}
+
+func (r *ReconnectSession) SetReceiveTimeout(d time.Duration) error {
+	return r.set(func(s Session) error { return s.SetReceiveTimeout(d) },
+		func(t *SessionTemplate) { t.ReceiveTimeout = d })
+}
+
+func (r *ReconnectSession) SetSendBuffer(size int) error {
+	return r.set(func(s Session) error { return s.SetSendBuffer(size) },
+		func(t *SessionTemplate) { t.SendBuffer = size })
+}
+
+func (r *ReconnectSession) SetReceiveBuffer(size int) error {
+	return r.set(func(s Session) error { return s.SetReceiveBuffer(size) },
+		func(t *SessionTemplate) { t.ReceiveBuffer = size })
+}
+
+func (r *ReconnectSession) SetMaxMessage(size int) error {
+	return r.set(func(s Session) error { return s.SetMaxMessage(size) },
+		func(t *SessionTemplate) { t.MaxMessage = size })
+}
+
+func (r *ReconnectSession) SetSendQueue(size int) error {
+	return r.set(func(s Session) error { return s.SetSendQueue(size) },
+		func(t *SessionTemplate) { t.SendQueue = size })
+}
+
+func (r *ReconnectSession) SetOverflowPolicy(p OverflowPolicy) error {
+	return r.set(func(s Session) error { return s.SetOverflowPolicy(p) },
+		func(t *SessionTemplate) { t.OverflowPolicy = p })
+}
+
+func (r *ReconnectSession) SetSendQueueType(qt QueueType) error {
+	return r.set(func(s Session) error { return s.SetSendQueueType(qt) },
+		func(t *SessionTemplate) { t.SendQueueType = qt })
+}
+
+// setStream applies the setting of stream sessions to the current session
+// and records it.
+func (r *ReconnectSession) setStream(apply func(streamSetter) error, record func(*SessionTemplate)) error {
+	return r.set(func(s Session) error {
+		ss, ok := s.(streamSetter)
+		if !ok {
+			return ErrNotStreamSession
+		}
+		return apply(ss)
+	}, record)
+}
+
+// SetFramer sets the Framer of stream sessions, see TCPSession.
+func (r *ReconnectSession) SetFramer(f Framer) error {
+	return r.setStream(func(ss streamSetter) error { return ss.SetFramer(f) },
+		func(t *SessionTemplate) { t.Framer = f })
+}
+
+// SetHeartbeat enables the heartbeat of stream sessions, see TCPSession.
+func (r *ReconnectSession) SetHeartbeat(interval, pongTimeout time.Duration, maxMissed int) error {
+	return r.setStream(func(ss streamSetter) error { return ss.SetHeartbeat(interval, pongTimeout, maxMissed) },
+		func(t *SessionTemplate) {
+			t.HeartbeatInterval = interval
+			t.PongTimeout = pongTimeout
+			t.MaxMissedPongs = maxMissed
+		})
+}
+
+// SetIdleTimeout sets the idle timeout of stream sessions, see TCPSession.
+func (r *ReconnectSession) SetIdleTimeout(d time.Duration) error {
+	return r.setStream(func(ss streamSetter) error { return ss.SetIdleTimeout(d) },
+		func(t *SessionTemplate) { t.IdleTimeout = d })
+}
+
+// SetCompression enables the compression of stream sessions, see TCPSession.
+func (r *ReconnectSession) SetCompression(c Compressor, threshold int) error {
+	return r.setStream(func(ss streamSetter) error { return ss.SetCompression(c, threshold) },
+		func(t *SessionTemplate) {
+			t.Compressor = c
+			t.CompressThreshold = threshold
+		})
+}
+
+// SetHandshake sets the handshake hook of stream sessions, which runs on
+// every connection, see TCPSession.
+func (r *ReconnectSession) SetHandshake(fn HandshakeFunc, timeout time.Duration) error {
+	return r.setStream(func(ss streamSetter) error { return ss.SetHandshake(fn, timeout) },
+		func(t *SessionTemplate) {
+			t.Handshake = fn
+			t.HandshakeTimeout = timeout
+		})
+}
+
+// Send sends the message by current session. During the connection lost,
+// the message is buffered if the policy allows, or ErrReconnecting returned.
+func (r *ReconnectSession) Send(msg interface{}) error {
+	return r.send(msg, func(s Session) error { return s.Send(msg) })
+}
+
+// SendPriority is the Send in priority, see Session.
+func (r *ReconnectSession) SendPriority(msg interface{}, prio Priority) error {
+	return r.send(msg, func(s Session) error { return s.SendPriority(msg, prio) })
+}
+
+// TrySend is the non-blocking Send, see Session.
+func (r *ReconnectSession) TrySend(msg interface{}) error {
+	return r.send(msg, func(s Session) error { return s.TrySend(msg) })
+}
+
+// SendContext is the Send waiting until ctx done, see Session.
+func (r *ReconnectSession) SendContext(ctx context.Context, msg interface{}) error {
+	return r.send(msg, func(s Session) error { return s.SendContext(ctx, msg) })
+}
+
+// Stats returns the statistics of current session, zero during the
+// connection lost.
+func (r *ReconnectSession) Stats() Stats {
+	r.mtx.Lock()
+	cur := r.cur
+	r.mtx.Unlock()
+
+	if cur == nil {
+		return Stats{}
+	}
+	return cur.Stats()
+}
+
+// send sends the message by current session with send, or buffers it.
+func (r *ReconnectSession) send(msg interface{}, send func(Session) error) error {
+	if msg == nil {
+		return ErrNilMessage
+	}
+
+	r.mtx.Lock()
+	if !r.started {
+		r.mtx.Unlock()
+		return ErrSessionNotStarted
+	}
+	if r.closed {
+		r.mtx.Unlock()
+		return ErrSessionClosed
+	}
+	if r.closing {
+		r.mtx.Unlock()
+		return ErrSessionClosing
+	}
+	if r.cur == nil || r.replaying {
+		err := r.bufferMessage(msg)
+		r.mtx.Unlock()
+		return err
+	}
+	cur := r.cur
+	r.mtx.Unlock()
+
+	err := send(cur)
+	if err == ErrSessionClosed {
+		// connection lost but not yet notified.
+		r.mtx.Lock()
+		defer r.mtx.Unlock()
+		if r.closed {
+			return ErrSessionClosed
+		}
+		return r.bufferMessage(msg)
+	}
+	return err
+}
+
+func (r *ReconnectSession) bufferMessage(msg interface{}) error {
+	if r.policy.BufferSize <= 0 {
+		return ErrReconnecting
+	}
+	if len(r.buffer) >= r.policy.BufferSize {
+		return ErrSendBufferFull
+	}
+	r.buffer = append(r.buffer, msg)
+	return nil
+}
+
+func (r *ReconnectSession) notifyEvent(evt Event) {
+	r.evtCB(r, evt)
+}
+
+// onEvent handles the events of underlying sessions.
+func (r *ReconnectSession) onEvent(s Session, evt Event) {
+	r.mtx.Lock()
+	if r.closed || s != r.cur {
+		// events of stale session.
+		r.mtx.Unlock()
+		return
+	}
+
+	if evt.Type() == EventType_Close {
+		if !r.closing && reconnectable(evt.Reason()) {
+			r.cur = nil
+			r.mtx.Unlock()
+			go r.reconnect(evt.Reason())
+			return
+		}
+		r.closed = true
+		close(r.closeCh)
+		r.buffer = nil
+	}
+	r.mtx.Unlock()
+
+	r.notifyEvent(evt)
+}
+
+func (r *ReconnectSession) reconnect(reason string) {
+	for attempt := 1; r.policy.MaxAttempts <= 0 || attempt <= r.policy.MaxAttempts; attempt++ {
+		r.notifyEvent(newEventReconnecting(attempt))
+
+		timer := time.NewTimer(r.policy.backoff(attempt))
+		select {
+		case <-r.closeCh:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s, err := r.dial(r.policy.ConnectTimeout)
+		if err != nil {
+			continue
+		}
+
+		r.mtx.Lock()
+		if r.closed {
+			r.mtx.Unlock()
+			discardSession(s)
+			return
+		}
+		if err := r.template.apply(s); err != nil {
+			r.mtx.Unlock()
+			discardSession(s)
+			continue
+		}
+		r.cur = s
+		r.replaying = true
+		r.mtx.Unlock()
+
+		if err := s.Start(r.onEvent); err != nil {
+			r.mtx.Lock()
+			if r.cur == s {
+				r.cur = nil
+				r.replaying = false
+			}
+			r.mtx.Unlock()
+			discardSession(s)
+			continue
+		}
+		r.notifyEvent(newEventReconnected(attempt))
+		r.replay(s)
+		return
+	}
+
+	// give up reconnecting.
+	r.mtx.Lock()
+	if r.closed {
+		r.mtx.Unlock()
+		return
+	}
+	r.closed = true
+	close(r.closeCh)
+	r.buffer = nil
+	r.mtx.Unlock()
+
+	r.notifyEvent(newEventClose(reason))
+}
+
+// replay sends the buffered messages by new session orderly, the messages
+// sent meanwhile are buffered until replay finished.
+func (r *ReconnectSession) replay(s Session) {
+	for {
+		r.mtx.Lock()
+		if r.cur != s {
+			// connection lost again.
+			r.mtx.Unlock()
+			return
+		}
+		if len(r.buffer) == 0 {
+			r.replaying = false
+			r.mtx.Unlock()
+			return
+		}
+		buffered := r.buffer
+		r.buffer = nil
+		r.mtx.Unlock()
+
+		for i, msg := range buffered {
+			if s.Send(msg) == ErrSessionClosed {
+				// keep the rest for next connection.
+				r.mtx.Lock()
+				if !r.closed {
+					r.buffer = append(buffered[i:], r.buffer...)
+				}
+				r.mtx.Unlock()
+				return
+			}
+		}
+	}
+}
+
+// discardSession closes the session which is not started.
+func discardSession(s Session) {
+	if ss, ok := s.(serverSession); ok {
+		ss.discard()
+	}
+}
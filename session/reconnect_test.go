@@ -0,0 +1,180 @@
+package session
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReconnect(t *testing.T) {
+	listener, err := ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	var (
+		accepted      int32
+		serverReceive int32
+	)
+	go func() {
+		for {
+			srvSession, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			srvSession.SetCodecs(&tcpCodecs{})
+			srvSession.Start(func(s Session, e Event) {
+				if e.Type() == EventType_Message {
+					atomic.AddInt32(&serverReceive, 1)
+				}
+			})
+
+			// close the first session to force client reconnecting.
+			if atomic.AddInt32(&accepted, 1) == 1 {
+				srvSession.Close()
+			}
+		}
+	}()
+
+	var (
+		reconnecting int32
+		reconnected  = make(chan int, 1)
+	)
+	cli, err := ConnectTCPReconnect("tcp4", listener.Addr(), ReconnectPolicy{
+		MinBackoff: 50 * time.Millisecond,
+		MaxBackoff: 200 * time.Millisecond,
+		Jitter:     0.2,
+		BufferSize: 10,
+	})
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	cli.SetCodecs(&tcpCodecs{})
+	cli.Start(func(s Session, e Event) {
+		if s != Session(cli) {
+			t.Errorf("event of session %d", s.ID())
+		}
+		switch e.Type() {
+		case EventType_Reconnecting:
+			atomic.AddInt32(&reconnecting, 1)
+		case EventType_Reconnected:
+			reconnected <- e.Attempt()
+		case EventType_Close:
+			t.Errorf("unexpected close, %s", e.Reason())
+		}
+	})
+
+	waitFor(t, func() bool { return atomic.LoadInt32(&reconnecting) > 0 }, "not reconnecting")
+
+	// messages sent during reconnecting are buffered and replayed.
+	sendMsgCount := 5
+	for i := 0; i < sendMsgCount; i++ {
+		if err := cli.Send(&stringMsg{msg: make([]byte, 10)}); err != nil {
+			t.Fatalf("send failed, %s", err)
+		}
+	}
+
+	select {
+	case attempt := <-reconnected:
+		if attempt < 1 {
+			t.Fatalf("reconnected attempt %d", attempt)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait reconnected timeout")
+	}
+
+	waitFor(t, func() bool { return atomic.LoadInt32(&serverReceive) == int32(sendMsgCount) }, "server receive %d", atomic.LoadInt32(&serverReceive))
+
+	if err := cli.Close(); err != nil {
+		t.Fatalf("close failed, %s", err)
+	}
+	if err := cli.Send(&stringMsg{msg: make([]byte, 10)}); err != ErrSessionClosed {
+		t.Fatalf("send after close returns %v", err)
+	}
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	p := ReconnectPolicy{MinBackoff: 10 * time.Millisecond, MaxBackoff: 100 * time.Millisecond, Multiplier: 2}
+	expected := []time.Duration{10, 20, 40, 80, 100, 100}
+	for i, d := range expected {
+		if b := p.backoff(i + 1); b != d*time.Millisecond {
+			t.Fatalf("backoff of attempt %d is %s, expected %s", i+1, b, d*time.Millisecond)
+		}
+	}
+}
+
+func TestReconnectSettings(t *testing.T) {
+	if _, err := ConnectTCPReconnect("tcp4", "127.0.0.1:1", ReconnectPolicy{Jitter: 1.5}); err != ErrReconnectPolicy {
+		t.Fatalf("connect with jitter 1.5, %v", err)
+	}
+
+	listener, err := ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	var (
+		framer    = NewUvarintFramer()
+		accepted  int32
+		received  = make(chan int, 10)
+		handshake = func(h Handshake) error { return nil }
+	)
+	go func() {
+		for {
+			srvSession, err := listener.AcceptTCP()
+			if err != nil {
+				return
+			}
+			srvSession.SetCodecs(&tcpCodecs{})
+			srvSession.SetFramer(framer)
+			srvSession.Start(func(s Session, e Event) {
+				if e.Type() == EventType_Message {
+					received <- len(e.Message().(*stringMsg).msg)
+				}
+			})
+
+			// close the first session to force client reconnecting.
+			if atomic.AddInt32(&accepted, 1) == 1 {
+				srvSession.Close()
+			}
+		}
+	}()
+
+	reconnected := make(chan struct{}, 1)
+	cli, err := ConnectTCPReconnect("tcp4", listener.Addr(), ReconnectPolicy{MinBackoff: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	cli.SetCodecs(&tcpCodecs{})
+	if err := cli.SetFramer(framer); err != nil {
+		t.Fatalf("set framer, %v", err)
+	}
+	if err := cli.SetHandshake(handshake, time.Second); err != nil {
+		t.Fatalf("set handshake, %v", err)
+	}
+	cli.Start(func(s Session, e Event) {
+		if e.Type() == EventType_Reconnected {
+			reconnected <- struct{}{}
+		}
+	})
+	defer cli.Close()
+
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait reconnected timeout")
+	}
+
+	// the framer is applied to the session reconnected.
+	cli.Send(&stringMsg{msg: make([]byte, 300)})
+	select {
+	case n := <-received:
+		if n != 300 {
+			t.Fatalf("server receive message of %d bytes", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait message timeout")
+	}
+}
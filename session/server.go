@@ -0,0 +1,335 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SessionTemplate is the configuration applied to every session accepted
+// by Server. Zero values mean the defaults of session.
+type SessionTemplate struct {
+	Codecs         Codecs         // 编解码器
+	SendTimeout    time.Duration  // 发送超时
+	ReceiveTimeout time.Duration  // 接收超时
+	SendBuffer     int            // 发送缓冲区大小
+	ReceiveBuffer  int            // 接收缓冲区大小
+	MaxMessage     int            // 最大消息大小
+	SendQueue      int            // 发送队列大小
+	OverflowPolicy OverflowPolicy // 发送队列溢出策略
+	SendQueueType  QueueType      // 发送队列实现
+
+	// The settings of stream sessions, ignored by others. The Cipher is
+	// per session, set it in Handshake by Handshake.SetCipher.
+	Framer            Framer        // 帧格式
+	HeartbeatInterval time.Duration // 心跳间隔，0表示不启用
+	PongTimeout       time.Duration // 心跳响应超时
+	MaxMissedPongs    int           // 最大连续未响应的心跳数
+	IdleTimeout       time.Duration // 空闲超时，0表示不启用
+	Compressor        Compressor    // 压缩器，nil表示不压缩
+	CompressThreshold int           // 压缩的最小消息长度
+	Handshake         HandshakeFunc // 握手回调
+	HandshakeTimeout  time.Duration // 握手超时
+}
+
+// streamSetter is implemented by the stream sessions.
+type streamSetter interface {
+	SetFramer(Framer) error
+	SetHeartbeat(interval, pongTimeout time.Duration, maxMissed int) error
+	SetIdleTimeout(time.Duration) error
+	SetCompression(Compressor, int) error
+	SetHandshake(HandshakeFunc, time.Duration) error
+}
+
+// apply the template to session.
+func (t *SessionTemplate) apply(s Session) error {
+	if err := s.SetCodecs(t.Codecs); err != nil {
+		return err
+	}
+	if t.SendTimeout > 0 {
+		if err := s.SetSendTimeout(t.SendTimeout); err != nil {
+			return err
+		}
+	}
+	if t.ReceiveTimeout > 0 {
+		if err := s.SetReceiveTimeout(t.ReceiveTimeout); err != nil {
+			return err
+		}
+	}
+	if t.SendBuffer > 0 {
+		if err := s.SetSendBuffer(t.SendBuffer); err != nil {
+			return err
+		}
+	}
+	if t.ReceiveBuffer > 0 {
+		if err := s.SetReceiveBuffer(t.ReceiveBuffer); err != nil {
+			return err
+		}
+	}
+	if t.MaxMessage > 0 {
+		if err := s.SetMaxMessage(t.MaxMessage); err != nil {
+			return err
+		}
+	}
+	if t.SendQueue > 0 {
+		if err := s.SetSendQueue(t.SendQueue); err != nil {
+			return err
+		}
+	}
+	if t.OverflowPolicy != OverflowPolicy_Block {
+		if err := s.SetOverflowPolicy(t.OverflowPolicy); err != nil {
+			return err
+		}
+	}
+	if t.SendQueueType != QueueType_Ring {
+		if err := s.SetSendQueueType(t.SendQueueType); err != nil {
+			return err
+		}
+	}
+	if ss, ok := s.(streamSetter); ok {
+		return t.applyStream(ss)
+	}
+	return nil
+}
+
+// applyStream applies the settings of stream sessions.
+func (t *SessionTemplate) applyStream(ss streamSetter) error {
+	if t.Framer != nil {
+		if err := ss.SetFramer(t.Framer); err != nil {
+			return err
+		}
+	}
+	if t.HeartbeatInterval > 0 {
+		if err := ss.SetHeartbeat(t.HeartbeatInterval, t.PongTimeout, t.MaxMissedPongs); err != nil {
+			return err
+		}
+	}
+	if t.IdleTimeout > 0 {
+		if err := ss.SetIdleTimeout(t.IdleTimeout); err != nil {
+			return err
+		}
+	}
+	if t.Compressor != nil {
+		if err := ss.SetCompression(t.Compressor, t.CompressThreshold); err != nil {
+			return err
+		}
+	}
+	if t.Handshake != nil {
+		if err := ss.SetHandshake(t.Handshake, t.HandshakeTimeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serverSession is implemented by all the sessions of this package.
+type serverSession interface {
+	Session
+	setCloseHook(func(Session))
+	closeWithEvent(reason string)
+	discard()
+}
+
+// Server runs the accept loops of listeners, configures and starts the
+// sessions accepted, and tracks the live sessions by ID.
+type Server struct {
+	template  SessionTemplate
+	evtCB     EventCallback
+	mtx       sync.RWMutex
+	listeners map[Listener]struct{}
+	sessions  map[uint64]serverSession
+	shutdown  bool
+}
+
+func NewServer(template SessionTemplate, evtCB EventCallback) (*Server, error) {
+	if template.Codecs == nil {
+		return nil, ErrNilCodecs
+	}
+	if evtCB == nil {
+		return nil, ErrNilEventCallback
+	}
+
+	return &Server{
+		template:  template,
+		evtCB:     evtCB,
+		listeners: make(map[Listener]struct{}),
+		sessions:  make(map[uint64]serverSession),
+	}, nil
+}
+
+// Serve accepts sessions on the listener until it closed or server shutdown.
+// It always returns non-nil error, ErrServerClosed after Shutdown.
+func (srv *Server) Serve(l Listener) error {
+	srv.mtx.Lock()
+	if srv.shutdown {
+		srv.mtx.Unlock()
+		return ErrServerClosed
+	}
+	srv.listeners[l] = struct{}{}
+	srv.mtx.Unlock()
+
+	defer func() {
+		srv.mtx.Lock()
+		delete(srv.listeners, l)
+		srv.mtx.Unlock()
+	}()
+
+	var tempDelay time.Duration
+	for {
+		s, err := l.Accept()
+		if err != nil {
+			if srv.isShutdown() {
+				return ErrServerClosed
+			}
+
+			if te, ok := err.(interface{ Temporary() bool }); ok && te.Temporary() {
+				// retry with backoff.
+				if tempDelay == 0 {
+					tempDelay = 5 * time.Millisecond
+				} else if tempDelay *= 2; tempDelay > time.Second {
+					tempDelay = time.Second
+				}
+				time.Sleep(tempDelay)
+				continue
+			}
+			return err
+		}
+		tempDelay = 0
+
+		srv.serveSession(s)
+	}
+}
+
+func (srv *Server) serveSession(s Session) {
+	ss, ok := s.(serverSession)
+	if !ok {
+		return
+	}
+
+	if err := srv.template.apply(ss); err != nil {
+		ss.discard()
+		return
+	}
+
+	srv.mtx.Lock()
+	if srv.shutdown {
+		srv.mtx.Unlock()
+		ss.discard()
+		return
+	}
+	srv.sessions[ss.ID()] = ss
+	srv.mtx.Unlock()
+
+	ss.setCloseHook(srv.removeSession)
+	if err := ss.Start(srv.evtCB); err != nil {
+		srv.removeSession(ss)
+		ss.discard()
+	}
+}
+
+func (srv *Server) removeSession(s Session) {
+	srv.mtx.Lock()
+	delete(srv.sessions, s.ID())
+	srv.mtx.Unlock()
+}
+
+func (srv *Server) isShutdown() bool {
+	srv.mtx.RLock()
+	defer srv.mtx.RUnlock()
+	return srv.shutdown
+}
+
+// Lookup returns the live session of the ID.
+func (srv *Server) Lookup(id uint64) (Session, bool) {
+	srv.mtx.RLock()
+	defer srv.mtx.RUnlock()
+	s, ok := srv.sessions[id]
+	return s, ok
+}
+
+// Range calls f sequentially for each live session. If f returns false,
+// range stops the iteration.
+func (srv *Server) Range(f func(Session) bool) {
+	for _, s := range srv.snapshot() {
+		if !f(s) {
+			return
+		}
+	}
+}
+
+// Len returns the number of live sessions.
+func (srv *Server) Len() int {
+	srv.mtx.RLock()
+	defer srv.mtx.RUnlock()
+	return len(srv.sessions)
+}
+
+// Broadcast sends the message to all live sessions, returns the number of
+// sessions sent successfully.
+func (srv *Server) Broadcast(msg interface{}) int {
+	n := 0
+	for _, s := range srv.snapshot() {
+		if s.Send(msg) == nil {
+			n++
+		}
+	}
+	return n
+}
+
+func (srv *Server) snapshot() []serverSession {
+	srv.mtx.RLock()
+	defer srv.mtx.RUnlock()
+	sessions := make([]serverSession, 0, len(srv.sessions))
+	for _, s := range srv.sessions {
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+// Shutdown closes all the listeners, then closes the sessions gracefully,
+// i.e., flushes the messages queued and waits for peers to close. If ctx
+// done before all the sessions closed, the rest are closed immediately with
+// reason CloseReason_LocalGracefulClose notified, and ctx's error is
+// returned.
+func (srv *Server) Shutdown(ctx context.Context) error {
+	srv.mtx.Lock()
+	if srv.shutdown {
+		srv.mtx.Unlock()
+		return ErrServerClosed
+	}
+	srv.shutdown = true
+	listeners := make([]Listener, 0, len(srv.listeners))
+	for l := range srv.listeners {
+		listeners = append(listeners, l)
+	}
+	srv.mtx.Unlock()
+
+	for _, l := range listeners {
+		l.Close()
+	}
+
+	var wg sync.WaitGroup
+	for _, s := range srv.snapshot() {
+		wg.Add(1)
+		go func(s Session) {
+			defer wg.Done()
+			s.CloseGracefully(0)
+		}(s)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		for _, s := range srv.snapshot() {
+			s.closeWithEvent(CloseReason_LocalGracefulClose)
+		}
+		return ctx.Err()
+	}
+}
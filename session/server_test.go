@@ -0,0 +1,175 @@
+package session
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, cond func() bool, format string, args ...interface{}) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf(format, args...)
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+}
+
+func TestServer(t *testing.T) {
+	var serverReceive int32
+	srv, err := NewServer(SessionTemplate{Codecs: &tcpCodecs{}, SendQueue: 100}, func(s Session, e Event) {
+		if e.Type() == EventType_Message {
+			atomic.AddInt32(&serverReceive, 1)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(listener) }()
+
+	var (
+		clientCount   = 3
+		clientReceive int32
+		clients       []Session
+	)
+	for i := 0; i < clientCount; i++ {
+		cli, err := ConnectTCP("tcp4", listener.Addr())
+		if err != nil {
+			t.Fatalf("connect server failed, %s", err)
+		}
+		cli.SetCodecs(&tcpCodecs{})
+		cli.Start(func(s Session, e Event) {
+			if e.Type() == EventType_Message {
+				atomic.AddInt32(&clientReceive, 1)
+			}
+		})
+		clients = append(clients, cli)
+	}
+
+	waitFor(t, func() bool { return srv.Len() == clientCount }, "server sessions %d", srv.Len())
+
+	var ids []uint64
+	srv.Range(func(s Session) bool {
+		ids = append(ids, s.ID())
+		return true
+	})
+	for _, id := range ids {
+		if s, ok := srv.Lookup(id); !ok || s.ID() != id {
+			t.Fatalf("lookup session %d failed", id)
+		}
+	}
+
+	if n := srv.Broadcast(&stringMsg{msg: make([]byte, 100)}); n != clientCount {
+		t.Fatalf("broadcast to %d sessions", n)
+	}
+	waitFor(t, func() bool { return atomic.LoadInt32(&clientReceive) == int32(clientCount) }, "client receive %d", atomic.LoadInt32(&clientReceive))
+
+	// session closed by remote is removed.
+	clients[0].Close()
+	waitFor(t, func() bool { return srv.Len() == clientCount-1 }, "server sessions %d", srv.Len())
+
+	// messages queued before shutdown are flushed.
+	for i := 0; i < 50; i++ {
+		srv.Broadcast(&stringMsg{msg: make([]byte, 100)})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown failed, %s", err)
+	}
+	if err := <-served; err != ErrServerClosed {
+		t.Fatalf("serve returns %v", err)
+	}
+	if srv.Len() != 0 {
+		t.Fatalf("server sessions %d after shutdown", srv.Len())
+	}
+	want := int32(clientCount + 50*(clientCount-1))
+	waitFor(t, func() bool { return atomic.LoadInt32(&clientReceive) == want },
+		"client receive %d, expected %d", atomic.LoadInt32(&clientReceive), want)
+
+	for _, cli := range clients[1:] {
+		cli.Close()
+	}
+}
+
+func TestServerStartFailed(t *testing.T) {
+	srv, err := NewServer(SessionTemplate{Codecs: &tcpCodecs{}}, func(s Session, e Event) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+	go ConnectTCP("tcp4", listener.Addr())
+	s, err := listener.AcceptTCP()
+	if err != nil {
+		t.Fatalf("accept failed, %s", err)
+	}
+
+	// the session closed before started is not registered.
+	s.discard()
+	srv.serveSession(s)
+	if srv.Len() != 0 {
+		t.Fatalf("server sessions %d after start failed", srv.Len())
+	}
+	if ls := listener.Stats(); ls.Active != 0 {
+		t.Fatalf("listener stats %+v after start failed", ls)
+	}
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+	reasons := make(chan string, 2)
+	srv, err := NewServer(SessionTemplate{Codecs: &tcpCodecs{}}, func(s Session, e Event) {
+		if e.Type() == EventType_Close {
+			reasons <- e.Reason()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	go srv.Serve(listener)
+
+	// the peer never closes.
+	conn, err := net.Dial("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	defer conn.Close()
+	waitFor(t, func() bool { return srv.Len() == 1 }, "server sessions %d", srv.Len())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("shutdown returns %v", err)
+	}
+	select {
+	case r := <-reasons:
+		if r != CloseReason_LocalGracefulClose {
+			t.Fatalf("close reason %q", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait close event timeout")
+	}
+	select {
+	case r := <-reasons:
+		t.Fatalf("close again, reason %q", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -1,9 +1,12 @@
 package session
 
 import (
+	"context"
+	"errors"
 	"github.com/Godyy/go-net/container/queue"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -11,20 +14,27 @@ const (
 	DefaultSendQueueSize   = 10
 	DefaultSendBuffSize    = 8192
 	DefaultReceiveBuffSize = 8192
+	DefaultWritevThreshold = 8192
 )
 
 // 会话事件回调
-type EventCallback func(*session, Event)
+type EventCallback func(Session, Event)
 
 // 套接字会话接口
 // 定义套接字网络会话的基本功能
 type Session interface {
+	// 会话ID，进程内唯一
+	ID() uint64
+
 	// 启动会话
 	Start(EventCallback) error
 
 	// 关闭会话
 	Close() error
 
+	// 优雅关闭会话，发送完队列中的消息并等待对端关闭，超时则强制关闭
+	CloseGracefully(timeout time.Duration) error
+
 	// 设置编解码器, 会话启动前
 	SetCodecs(Codecs) error
 
@@ -46,11 +56,97 @@ type Session interface {
 	// 设置发送队列大小
 	SetSendQueue(size int) error
 
+	// 设置发送队列溢出策略，会话启动前
+	SetOverflowPolicy(OverflowPolicy) error
+
+	// 设置发送队列实现，会话启动前
+	SetSendQueueType(QueueType) error
+
 	// 设置选项
 	//SetOptions(options ...interface{})
 
-	// 发送消息
+	// 发送消息，发送队列满时按溢出策略处理
 	Send(msg interface{}) error
+
+	// 以指定优先级发送消息，高优先级的消息先发送
+	SendPriority(msg interface{}, prio Priority) error
+
+	// 发送消息，发送队列满时返回ErrSendQueueFull
+	TrySend(msg interface{}) error
+
+	// 发送消息，发送队列满时等待直到ctx结束
+	SendContext(ctx context.Context, msg interface{}) error
+
+	// 获取统计数据
+	Stats() Stats
+}
+
+// Priority is the priority of messages sending, the messages of higher
+// priority are sent first. Each priority has a send queue of the size set.
+type Priority int8
+
+const (
+	Priority_Low    = Priority(0)
+	Priority_Normal = Priority(1) // Send
+	Priority_High   = Priority(2) // 控制帧
+)
+
+// sendBatchSize is the max messages popped from send queue at once.
+const sendBatchSize = 32
+
+// priorityBurst is the max successive messages of higher priority sent while
+// the lower ones waiting, to avoid starvation.
+const priorityBurst = 16
+
+// OverflowPolicy is the policy of Send when the send queue is full.
+type OverflowPolicy int8
+
+const (
+	// block until the queue not full.
+	OverflowPolicy_Block = OverflowPolicy(0)
+
+	// drop the message sending, ErrSendQueueFull returned.
+	OverflowPolicy_DropNewest = OverflowPolicy(1)
+
+	// drop the oldest messages in queue.
+	OverflowPolicy_DropOldest = OverflowPolicy(2)
+
+	// close the session with reason CloseReason_QueueOverflow,
+	// ErrSendQueueFull returned.
+	OverflowPolicy_CloseSession = OverflowPolicy(3)
+)
+
+// QueueType is the implementation of send queues.
+type QueueType int8
+
+const (
+	// the bounded lock-free ring queue, the size set is exact except 1,
+	// which is raised to 2.
+	QueueType_Ring = QueueType(0)
+
+	// the unbounded linked queue, the size set and overflow policy are
+	// ignored.
+	QueueType_Linked = QueueType(1)
+
+	// the bounded queue on channel.
+	QueueType_Chan = QueueType(2)
+)
+
+// newSendQueue returns the send queue of type t, each priority holds at most
+// size messages.
+func newSendQueue(t QueueType, size int) *queue.PriorityQueue {
+	levels := make([]queue.Queue, Priority_High+1)
+	for i := range levels {
+		switch t {
+		case QueueType_Linked:
+			levels[i] = queue.NewLinkedQueue()
+		case QueueType_Chan:
+			levels[i] = queue.NewChanQueue(size)
+		default:
+			levels[i] = queue.NewRingQueue(size)
+		}
+	}
+	return queue.NewPriorityQueue(levels, priorityBurst)
 }
 
 type sessionImpl interface {
@@ -59,37 +155,72 @@ type sessionImpl interface {
 	receiveThread()
 }
 
+// handshaker is implemented by sessions that must complete a handshake
+// before sending and receiving messages.
+type handshaker interface {
+	handshake() error
+}
+
+// handshakeHook is implemented by sessions running the handshake hook set by
+// user, after the handshake of protocol.
+type handshakeHook interface {
+	runHandshake() error
+}
+
+// closeWriter is implemented by the connections which support half-close.
+type closeWriter interface {
+	CloseWrite() error
+}
+
 const (
 	sessionStarted = 1 << 0
 	sessionClosed  = 1 << 1
+	sessionClosing = 1 << 2
 )
 
+// sessionID generates the session IDs.
+var sessionID uint64
+
 type session struct {
+	id              uint64
 	impl            sessionImpl
 	mtx             sync.Mutex
 	state           int32
 	conn            net.Conn
-	codecs          Codecs           // 编解码器
-	sendTimeout     time.Duration    // 发送超时
-	receiveTimeout  time.Duration    // 接收超时
-	sendBuffSize    int              // 发送缓冲区大小
-	receiveBuffSize int              // 接收缓冲区大小
-	maxMsgSize      int              // 最大消息大小
-	sendQueueSize   int              // 发送队列大小
-	sendQueue       *queue.ChanQueue // 发送队列
-	evtCB           EventCallback    // 事件回调
-}
-
-func newSession(impl sessionImpl, conn net.Conn) session {
+	codecs          Codecs               // 编解码器
+	sendTimeout     time.Duration        // 发送超时
+	receiveTimeout  time.Duration        // 接收超时
+	sendBuffSize    int                  // 发送缓冲区大小
+	receiveBuffSize int                  // 接收缓冲区大小
+	maxMsgSize      int                  // 最大消息大小
+	sendQueueSize   int                  // 发送队列大小
+	sendQueue       *queue.PriorityQueue // 发送队列
+	overflowPolicy  OverflowPolicy       // 发送队列溢出策略
+	sendQueueType   QueueType            // 发送队列实现
+	sendBatchBuf    []interface{}        // 批量出队缓冲区，仅发送线程访问
+	sendBatch       []interface{}        // 已出队未发送的消息，仅发送线程访问
+	evtCB           EventCallback        // 事件回调
+	closeHook       func(Session)        // 关闭回调
+	closeCh         chan struct{}        // 会话关闭后关闭
+	stats           *sessionStats        // 统计数据
+}
+
+func newSession(impl sessionImpl, conn net.Conn, maxMsgSize int) session {
 	return session{
+		id:              atomic.AddUint64(&sessionID, 1),
 		impl:            impl,
 		conn:            conn,
 		sendBuffSize:    DefaultSendBuffSize,
 		receiveBuffSize: DefaultReceiveBuffSize,
+		maxMsgSize:      maxMsgSize,
 		sendQueueSize:   DefaultSendQueueSize,
+		closeCh:         make(chan struct{}),
+		stats:           newSessionStats(),
 	}
 }
 
+func (s *session) ID() uint64 { return s.id }
+
 func (s *session) Start(evtCB EventCallback) error {
 	if evtCB == nil {
 		return ErrNilEventCallback
@@ -110,38 +241,220 @@ func (s *session) Start(evtCB EventCallback) error {
 		return ErrSessionClosed
 	}
 
-	s.sendQueue = queue.NewChanQueue(s.sendQueueSize)
+	s.sendQueue = newSendQueue(s.sendQueueType, s.sendQueueSize)
+	s.sendBatchBuf = make([]interface{}, sendBatchSize)
 
 	s.evtCB = evtCB
 	s.state |= sessionStarted
 
-	go s.impl.sendThread()
-	go s.impl.receiveThread()
+	go s.run()
 
 	return nil
 }
 
+// run performs the handshake of session if necessary, and then starts
+// the sending and receiving threads.
+func (s *session) run() {
+	if h, ok := s.impl.(handshaker); ok {
+		if err := h.handshake(); err != nil {
+			s.handshakeFailed(err)
+			return
+		}
+	}
+	if h, ok := s.impl.(handshakeHook); ok {
+		if err := h.runHandshake(); err != nil {
+			s.handshakeFailed(err)
+			return
+		}
+	}
+
+	go func() {
+		s.impl.sendThread()
+		s.releasePending()
+	}()
+	s.impl.receiveThread()
+}
+
+// handshakeFailed closes the session failed in handshake.
+func (s *session) handshakeFailed(err error) {
+	// if session had been closed, directly return.
+	if s.isClosed(true) {
+		return
+	}
+
+	s.Close()
+
+	var re *RejectError
+	if errors.As(err, &re) {
+		s.notifyEvent(newEventClose(re.Reason))
+		return
+	}
+	s.notifyEvent(newEventError(newError(ErrorType_Handshake, err)))
+	s.notifyEvent(newEventClose(CloseReason_HandshakeFailed))
+}
+
 func (s *session) Close() error {
 	s.mtx.Lock()
-	defer s.mtx.Unlock()
 
 	if !s.isStarted(false) {
+		s.mtx.Unlock()
 		return ErrSessionNotStarted
 	}
 
 	if s.isClosed(false) {
+		s.mtx.Unlock()
 		return ErrSessionClosed
 	}
 
 	s.state |= sessionClosed
 	s.conn.Close()
-	s.conn = nil
-	s.sendQueue.Destroy()
-	s.sendQueue = nil
+	s.sendQueue.Close()
+	close(s.closeCh)
+	s.closeStats()
+	closeHook := s.closeHook
+	s.mtx.Unlock()
+
+	// the messages never to be sent.
+	s.drainQueue()
+
+	if closeHook != nil {
+		closeHook(s.impl)
+	}
 
 	return nil
 }
 
+// CloseGracefully stops accepting new messages, flushes the messages queued,
+// shuts down the writing side of connection and waits for peer to close. If
+// timeout (non-positive means no limit) elapsed before that, the session is
+// closed immediately and ErrCloseTimeout returned. Either way, one
+// EventType_Close with CloseReason_LocalGracefulClose is notified.
+func (s *session) CloseGracefully(timeout time.Duration) error {
+	s.mtx.Lock()
+	if !s.isStarted(false) {
+		s.mtx.Unlock()
+		return ErrSessionNotStarted
+	}
+	if s.isClosed(false) {
+		s.mtx.Unlock()
+		return ErrSessionClosed
+	}
+	if s.isClosing(false) {
+		s.mtx.Unlock()
+		return ErrSessionClosing
+	}
+
+	s.state |= sessionClosing
+	// wake up the sendThread waiting for messages, if the queue is full,
+	// it will find out closing after popped.
+	s.sendQueue.TryPush(struct{}{}, priorityLevel(Priority_High))
+	s.mtx.Unlock()
+
+	var timeoutC <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutC = timer.C
+	}
+
+	select {
+	case <-s.closeCh:
+		return nil
+	case <-timeoutC:
+		s.closeWithEvent(CloseReason_LocalGracefulClose)
+		return ErrCloseTimeout
+	}
+}
+
+// closeWrite shuts down the writing side of connection after the messages
+// flushed while closing gracefully, the session is closed by receiveThread
+// once peer closes too. If the connection does not support half-close, the
+// session is closed immediately.
+func (s *session) closeWrite() {
+	if cw, ok := s.conn.(closeWriter); ok && cw.CloseWrite() == nil {
+		return
+	}
+	s.closeWithEvent(CloseReason_LocalGracefulClose)
+}
+
+// closeWithEvent closes the session and notifies the close event. The reason
+// is replaced by CloseReason_LocalGracefulClose if the session is closing
+// gracefully.
+func (s *session) closeWithEvent(reason string) {
+	if s.isClosing(true) {
+		reason = CloseReason_LocalGracefulClose
+	}
+	if s.Close() == nil {
+		s.notifyEvent(newEventClose(reason))
+	}
+}
+
+// popMessage pops the next message to send, returns nil if there is none.
+// The messages are popped from send queue in batch, so a message of higher
+// priority may be sent after at most sendBatchSize ones popped before.
+func (s *session) popMessage(wait bool) Message {
+	if len(s.sendBatch) == 0 {
+		n := s.sendQueue.PopBatch(s.sendBatchBuf, wait)
+		if n == 0 {
+			return nil
+		}
+		s.sendBatch = s.sendBatchBuf[:n]
+	}
+
+	msg, _ := s.sendBatch[0].(Message)
+	s.sendBatch[0] = nil
+	s.sendBatch = s.sendBatch[1:]
+	return msg
+}
+
+// releasePending releases the messages not sent after the sending thread
+// exited, including the ones popped in batch.
+func (s *session) releasePending() {
+	for _, o := range s.sendBatch {
+		if m, ok := o.(Message); ok {
+			m.Release()
+		}
+	}
+	s.sendBatch = nil
+	s.drainQueue()
+}
+
+// drainQueue releases the messages left in send queue, it may run along
+// with the sending thread.
+func (s *session) drainQueue() {
+	for o := s.sendQueue.Pop(false); o != nil; o = s.sendQueue.Pop(false) {
+		// the wake-up of closing is not a message.
+		if m, ok := o.(Message); ok {
+			m.Release()
+		}
+	}
+}
+
+// sendPending returns the number of messages waiting for sending.
+func (s *session) sendPending() int {
+	return s.sendQueue.Len() + len(s.sendBatch)
+}
+
+// discard closes the connection of session which is not started.
+func (s *session) discard() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if !s.isStarted(false) && !s.isClosed(false) {
+		s.state |= sessionClosed
+		s.conn.Close()
+		close(s.closeCh)
+		s.closeStats()
+	}
+}
+
+// setCloseHook set the function called once the session closed.
+func (s *session) setCloseHook(f func(Session)) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.closeHook = f
+}
+
 func (s *session) SetCodecs(c Codecs) error {
 	if c == nil {
 		return ErrNilCodecs
@@ -264,30 +577,161 @@ func (s *session) SetSendQueue(size int) error {
 	return nil
 }
 
+// SetOverflowPolicy sets the policy of Send when the send queue is full, the
+// error of type ErrorType_QueueOverflow is notified if not blocked.
+func (s *session) SetOverflowPolicy(p OverflowPolicy) error {
+	if p < OverflowPolicy_Block || p > OverflowPolicy_CloseSession {
+		return ErrOverflowPolicy
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.isStarted(false) {
+		return ErrSessionStarted
+	}
+	if s.isClosed(false) {
+		return ErrSessionClosed
+	}
+
+	s.overflowPolicy = p
+	return nil
+}
+
+// SetSendQueueType sets the implementation of send queue.
+func (s *session) SetSendQueueType(t QueueType) error {
+	if t < QueueType_Ring || t > QueueType_Chan {
+		return ErrQueueType
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.isStarted(false) {
+		return ErrSessionStarted
+	}
+	if s.isClosed(false) {
+		return ErrSessionClosed
+	}
+
+	s.sendQueueType = t
+	return nil
+}
+
+// priorityLevel returns the level of send queue of priority.
+func priorityLevel(prio Priority) int { return int(Priority_High - prio) }
+
 func (s *session) Send(msg interface{}) error {
+	return s.SendPriority(msg, Priority_Normal)
+}
+
+func (s *session) SendPriority(msg interface{}, prio Priority) error {
+	if prio < Priority_Low || prio > Priority_High {
+		return ErrPriority
+	}
+
+	m, err := s.encode(msg)
+	if err != nil {
+		return err
+	}
+
+	level := priorityLevel(prio)
+	if s.overflowPolicy == OverflowPolicy_Block {
+		return s.pushed(m, s.sendQueue.Push(m, level))
+	}
+	if err := s.sendQueue.TryPush(m, level); err != queue.ErrQueueFull {
+		return s.pushed(m, err)
+	}
+
+	s.notifyEvent(newEventError(newError(ErrorType_QueueOverflow, ErrSendQueueFull)))
+	switch s.overflowPolicy {
+	case OverflowPolicy_DropOldest:
+		for {
+			err := s.sendQueue.TryPush(m, level)
+			if err != queue.ErrQueueFull {
+				return s.pushed(m, err)
+			}
+			if old, ok := s.sendQueue.PopLevel(level).(Message); ok {
+				old.Release()
+			}
+		}
+
+	case OverflowPolicy_CloseSession:
+		m.Release()
+		s.closeWithEvent(CloseReason_QueueOverflow)
+		return ErrSendQueueFull
+
+	default:
+		m.Release()
+		return ErrSendQueueFull
+	}
+}
+
+func (s *session) TrySend(msg interface{}) error {
+	m, err := s.encode(msg)
+	if err != nil {
+		return err
+	}
+
+	return s.pushed(m, s.sendQueue.TryPush(m, priorityLevel(Priority_Normal)))
+}
+
+func (s *session) SendContext(ctx context.Context, msg interface{}) error {
+	m, err := s.encode(msg)
+	if err != nil {
+		return err
+	}
+
+	return s.pushed(m, s.sendQueue.PushContext(ctx, m, priorityLevel(Priority_Normal)))
+}
+
+// pushed releases m failed pushing to send queue, and returns the error of
+// session.
+func (s *session) pushed(m Message, err error) error {
+	switch err {
+	case nil:
+		s.queued()
+		return nil
+	case queue.ErrQueueClosed:
+		err = ErrSessionClosed
+	case queue.ErrQueueFull:
+		err = ErrSendQueueFull
+	}
+	m.Release()
+	return err
+}
+
+// encode encodes the message to send if session available.
+func (s *session) encode(msg interface{}) (Message, error) {
 	if msg == nil {
-		return ErrNilMessage
+		return nil, ErrNilMessage
 	}
 
 	s.mtx.Lock()
 	if !s.isStarted(false) {
 		s.mtx.Unlock()
-		return ErrSessionNotStarted
+		return nil, ErrSessionNotStarted
 	}
 	if s.isClosed(false) {
 		s.mtx.Unlock()
-		return ErrSessionClosed
+		return nil, ErrSessionClosed
+	}
+	if s.isClosing(false) {
+		s.mtx.Unlock()
+		return nil, ErrSessionClosing
 	}
+	// lowered by the cipher set in handshake.
+	maxMsgSize := s.maxMsgSize
 	s.mtx.Unlock()
 
 	if msgCoded, err := s.codecs.Encode(msg); err != nil {
-		return err
+		return nil, err
 	} else {
-		if msgCoded.Length() > s.maxMsgSize {
-			return ErrMsgTooLarge
+		if msgCoded.Length() > maxMsgSize {
+			msgCoded.Release()
+			return nil, ErrMsgTooLarge
 		}
-		s.sendQueue.Push(msgCoded)
-		return nil
+		return msgCoded, nil
 	}
 }
 
@@ -307,6 +751,14 @@ func (s *session) isClosed(lock bool) bool {
 	return s.state&sessionClosed > 0
 }
 
+func (s *session) isClosing(lock bool) bool {
+	if lock {
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+	}
+	return s.state&sessionClosing > 0
+}
+
 func (s *session) notifyEvent(evt Event) {
-	s.evtCB(s, evt)
+	s.evtCB(s.impl, evt)
 }
@@ -1,6 +1,8 @@
 package session
 
-// Listener is a generic listener for stream-oriented socket-session.
+import "os"
+
+// Listener is a generic listener for socket-session.
 type Listener interface {
 	// Waits for the next connection, constructs and returns the socket-session.
 	Accept() (Session, error)
@@ -8,11 +10,14 @@ type Listener interface {
 	// Close the listener, any blocked Accept() operation will be unblocked and return error.
 	Close() error
 
-	// Return name of the network. ("tcp", "tcp4")
+	// Return name of the network. ("tcp", "tcp4", "udp")
 	Network() string
 
 	// Return string form of the address listening.
 	Addr() string
+
+	// Return the aggregate statistics of the sessions accepted.
+	Stats() ListenerStats
 }
 
 // Codecs is a generic coder-decoder for all type of socket-session.
@@ -20,6 +25,30 @@ type Codecs interface {
 	// Code the message giving.
 	Encode(o interface{}) (Message, error)
 
-	// Decode try to decode the byte slice giving to a message object.
+	// Decode try to decode the byte slice giving to a message object. The
+	// byte slice is owned by session, and reused once Decode returned, so it
+	// must be copied if retained by the message object.
 	Decode(bytes []byte) (interface{}, error)
 }
+
+// PooledCodecs is a Codecs taking the ownership of message data received by
+// stream sessions, e.g., to reference the data in message object without
+// copy.
+type PooledCodecs interface {
+	Codecs
+
+	// DecodePooled try to decode the byte slice allocated from BytesPool to a
+	// message object. The ownership of byte slice is transferred, it must be
+	// returned by BytesPool.Put once not used.
+	DecodePooled(bytes []byte) (interface{}, error)
+}
+
+// FileCodecs is a Codecs accepting files passed by peer of "unixpacket" sessions.
+// If Codecs of session does not implement it, the files received will be closed.
+type FileCodecs interface {
+	Codecs
+
+	// DecodeFiles try to decode the byte slice and the files received along
+	// with it to a message object. The ownership of files is transferred.
+	DecodeFiles(bytes []byte, files []*os.File) (interface{}, error)
+}
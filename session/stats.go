@@ -0,0 +1,173 @@
+package session
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Counters is the traffic counters of sessions.
+type Counters struct {
+	BytesSent        uint64 // 发送字节数
+	BytesReceived    uint64 // 接收字节数
+	MessagesSent     uint64 // 发送消息数
+	MessagesReceived uint64 // 接收消息数
+	DecodeErrors     uint64 // 解码失败的消息数
+	Oversized        uint64 // 超长丢弃的消息数
+	Timeouts         uint64 // 发送、接收超时次数
+}
+
+// Stats is the statistics of session.
+type Stats struct {
+	Counters
+	SendQueueLen       int       // 发送队列长度
+	SendQueueHighWater int       // 发送队列长度最高值
+	ConnectTime        time.Time // 连接建立时间
+}
+
+// ListenerStats is the aggregate statistics of the sessions accepted by
+// listener.
+type ListenerStats struct {
+	Counters
+	Accepted uint64 // 接受的会话数
+	Active   int64  // 未关闭的会话数
+}
+
+type counter int
+
+const (
+	counterBytesSent = counter(iota)
+	counterBytesReceived
+	counterMessagesSent
+	counterMessagesReceived
+	counterDecodeErrors
+	counterOversized
+	counterTimeouts
+	counterNum
+)
+
+// counters is the Counters updated atomically.
+type counters [counterNum]uint64
+
+func (c *counters) add(i counter, n int) {
+	atomic.AddUint64(&c[i], uint64(n))
+}
+
+func (c *counters) load() Counters {
+	return Counters{
+		BytesSent:        atomic.LoadUint64(&c[counterBytesSent]),
+		BytesReceived:    atomic.LoadUint64(&c[counterBytesReceived]),
+		MessagesSent:     atomic.LoadUint64(&c[counterMessagesSent]),
+		MessagesReceived: atomic.LoadUint64(&c[counterMessagesReceived]),
+		DecodeErrors:     atomic.LoadUint64(&c[counterDecodeErrors]),
+		Oversized:        atomic.LoadUint64(&c[counterOversized]),
+		Timeouts:         atomic.LoadUint64(&c[counterTimeouts]),
+	}
+}
+
+// sessionStats is the statistics of session, updated by the sending and
+// receiving threads.
+type sessionStats struct {
+	counters       counters
+	queueHighWater int64          // 发送队列长度最高值
+	connectTime    time.Time      // 连接建立时间
+	listener       *listenerStats // 接受会话的监听器统计，启动前设置
+}
+
+func newSessionStats() *sessionStats {
+	return &sessionStats{connectTime: time.Now()}
+}
+
+// listenerStats is the statistics of listener, it must be the first field
+// of listener to be 64-bit aligned.
+type listenerStats struct {
+	counters counters
+	accepted uint64
+	active   int64
+}
+
+// accept counts the session accepted by listener.
+func (l *listenerStats) accept(s Session) {
+	if ls, ok := s.(interface{ setListenerStats(*listenerStats) }); ok {
+		ls.setListenerStats(l)
+		atomic.AddUint64(&l.accepted, 1)
+		atomic.AddInt64(&l.active, 1)
+	}
+}
+
+func (l *listenerStats) load() ListenerStats {
+	return ListenerStats{
+		Counters: l.counters.load(),
+		Accepted: atomic.LoadUint64(&l.accepted),
+		Active:   atomic.LoadInt64(&l.active),
+	}
+}
+
+// count adds n to the counter of session and the listener accepted it.
+func (s *session) count(i counter, n int) {
+	s.stats.counters.add(i, n)
+	if l := s.stats.listener; l != nil {
+		l.counters.add(i, n)
+	}
+}
+
+// countError counts the error occurred in sending or receiving.
+func (s *session) countError(err error) {
+	if isTimeout(err) {
+		s.count(counterTimeouts, 1)
+	}
+}
+
+// queued updates the high-water mark of send queue after message pushed.
+func (s *session) queued() {
+	n := int64(s.sendQueue.Len())
+	for {
+		hw := atomic.LoadInt64(&s.stats.queueHighWater)
+		if n <= hw || atomic.CompareAndSwapInt64(&s.stats.queueHighWater, hw, n) {
+			return
+		}
+	}
+}
+
+// sent counts the message sent, except control frames.
+func (s *session) sent(msg Message) {
+	if _, ok := msg.(*controlMessage); !ok {
+		s.count(counterMessagesSent, 1)
+	}
+}
+
+// countReader counts the bytes read from r as received by session.
+type countReader struct {
+	r io.Reader
+	s *session
+}
+
+func (c countReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.s.count(counterBytesReceived, n)
+	return n, err
+}
+
+func (s *session) setListenerStats(l *listenerStats) {
+	s.stats.listener = l
+}
+
+// closeStats counts the session closed.
+func (s *session) closeStats() {
+	if l := s.stats.listener; l != nil {
+		atomic.AddInt64(&l.active, -1)
+	}
+}
+
+// Stats returns the statistics of session.
+func (s *session) Stats() Stats {
+	st := Stats{
+		Counters:           s.stats.counters.load(),
+		SendQueueHighWater: int(atomic.LoadInt64(&s.stats.queueHighWater)),
+		ConnectTime:        s.stats.connectTime,
+	}
+	if s.isStarted(true) {
+		st.SendQueueLen = s.sendQueue.Len()
+	}
+	return st
+}
@@ -0,0 +1,94 @@
+package session
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+// badCodecs fails decoding the message "bad".
+type badCodecs struct {
+	tcpCodecs
+}
+
+func (c *badCodecs) Decode(b []byte) (interface{}, error) {
+	if bytes.Equal(b, []byte("bad")) {
+		return nil, errors.New("bad message")
+	}
+	return c.tcpCodecs.Decode(b)
+}
+
+func TestStats(t *testing.T) {
+	listener, err := ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	const msgCount, msgSize = 10, 100
+	var (
+		srvCh  = make(chan Session, 1)
+		events = make(chan Event, 100)
+	)
+	go func() {
+		srvSession, err := listener.AcceptTCP()
+		if err != nil {
+			return
+		}
+		srvSession.SetCodecs(&badCodecs{})
+		srvSession.SetMaxMessage(1000)
+		srvSession.Start(func(s Session, e Event) { events <- e })
+		srvCh <- srvSession
+	}()
+
+	start := time.Now()
+	cliSession, err := ConnectTCP("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	defer cliSession.Close()
+
+	cliSession.SetCodecs(&tcpCodecs{})
+	cliSession.Start(func(s Session, e Event) {})
+	for i := 0; i < msgCount; i++ {
+		cliSession.Send(&stringMsg{msg: make([]byte, msgSize)})
+	}
+	cliSession.Send(&stringMsg{msg: []byte("bad")})
+	cliSession.Send(&stringMsg{msg: make([]byte, 2000)})
+	for i := 0; i < msgCount; i++ {
+		waitEvent(t, events, EventType_Message)
+	}
+
+	srvSession := <-srvCh
+	wantBytes := uint64(msgCount*(msgSize+4) + 3 + 4 + 2000 + 4)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st := srvSession.Stats()
+		if st.BytesReceived == wantBytes && st.DecodeErrors == 1 && st.Oversized == 1 {
+			if st.MessagesReceived != msgCount {
+				t.Fatalf("server stats %+v", st)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server stats %+v, expected bytes received %d", st, wantBytes)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	st := cliSession.Stats()
+	if st.MessagesSent != msgCount+2 || st.BytesSent != wantBytes || st.SendQueueHighWater < 1 ||
+		st.ConnectTime.Before(start) || st.ConnectTime.After(time.Now()) {
+		t.Fatalf("client stats %+v", st)
+	}
+
+	ls := listener.Stats()
+	if ls.Accepted != 1 || ls.Active != 1 || ls.MessagesReceived != msgCount || ls.BytesReceived != wantBytes {
+		t.Fatalf("listener stats %+v", ls)
+	}
+	srvSession.Close()
+	if ls := listener.Stats(); ls.Active != 0 {
+		t.Fatalf("listener stats %+v after session closed", ls)
+	}
+}
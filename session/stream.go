@@ -0,0 +1,619 @@
+package session
+
+import (
+	"github.com/Godyy/go-net/io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// streamSession implements the message framing over stream-oriented
+// connections, the messages are delimited by Framer, DefaultFramer if not
+// set.
+type streamSession struct {
+	session
+	framer            Framer
+	hb                *heartbeat
+	compressor        Compressor    // 消息压缩器
+	compressThreshold int           // 压缩消息的最小长度
+	peerCompress      int32         // 对端已通告支持压缩
+	cipher            Cipher        // 消息加密
+	handshakeFn       HandshakeFunc // 握手回调
+	handshakeTimeout  time.Duration // 握手超时
+	pending           []byte        // 握手时多接收的数据
+	writevThreshold   int           // 不经发送缓冲区直接写出的最小消息长度
+	flushDelay        time.Duration // 发送缓冲区未满时延迟写出的时长
+}
+
+func newStreamSession(impl sessionImpl, conn net.Conn) streamSession {
+	return streamSession{
+		session: newSession(impl, conn, TCPDefaultMaxMsgSize),
+		framer:  DefaultFramer,
+		hb:      &heartbeat{},
+
+		writevThreshold: DefaultWritevThreshold,
+	}
+}
+
+// SetFramer sets the Framer delimiting messages, before session started. The
+// max size of message is lowered if exceeds the limit of Framer.
+func (ss *streamSession) SetFramer(f Framer) error {
+	if f == nil {
+		return ErrNilFramer
+	}
+
+	ss.mtx.Lock()
+	defer ss.mtx.Unlock()
+
+	if ss.isStarted(false) {
+		return ErrSessionStarted
+	}
+	if ss.isClosed(false) {
+		return ErrSessionClosed
+	}
+	if ss.cipher != nil && !cipherFramer(f) {
+		return ErrCipherConfig
+	}
+
+	ss.framer = f
+	ss.limitMaxMessage()
+	return nil
+}
+
+// SetWritevThreshold sets the min length of message data written without
+// copying to send buffer, before session started. The data is written along
+// with the headers buffered in a writev call, which is preferred for large
+// messages. Zero disables it.
+func (ss *streamSession) SetWritevThreshold(size int) error {
+	if size < 0 {
+		return ErrBuffSize
+	}
+
+	ss.mtx.Lock()
+	defer ss.mtx.Unlock()
+
+	if ss.isStarted(false) {
+		return ErrSessionStarted
+	}
+	if ss.isClosed(false) {
+		return ErrSessionClosed
+	}
+
+	ss.writevThreshold = size
+	return nil
+}
+
+// SetFlushDelay sets the delay of writing the send buffer not full, before
+// session started. The messages sent during the delay are coalesced into one
+// write, which trades latency for throughput like Nagle's algorithm. Zero
+// disables it.
+func (ss *streamSession) SetFlushDelay(d time.Duration) error {
+	if d < 0 {
+		return ErrFlushDelay
+	}
+
+	ss.mtx.Lock()
+	defer ss.mtx.Unlock()
+
+	if ss.isStarted(false) {
+		return ErrSessionStarted
+	}
+	if ss.isClosed(false) {
+		return ErrSessionClosed
+	}
+
+	ss.flushDelay = d
+	return nil
+}
+
+// SetMaxMessage sets the max size of message, before session started. It is
+// limited by the Framer and the overhead of Cipher, so that the messages too
+// large are rejected by Send.
+func (ss *streamSession) SetMaxMessage(size int) error {
+	if size > ss.maxMessage() {
+		return ErrMaxMsgSize
+	}
+	return ss.session.SetMaxMessage(size)
+}
+
+// maxMessage returns the max size of message can be framed and encrypted.
+func (ss *streamSession) maxMessage() int {
+	return maxSizeOf(ss.framer) - ss.cipherOverhead()
+}
+
+// limitMaxMessage lowers the max size of message to the limit of framing.
+func (ss *streamSession) limitMaxMessage() {
+	if max := ss.maxMessage(); ss.maxMsgSize > max {
+		ss.maxMsgSize = max
+	}
+}
+
+func (ss *streamSession) sendThread() {
+	var (
+		sendBuffer = io.NewBinaryBuffer(maxInt(ss.sendBuffSize, ss.framer.HeaderLen()))
+		header     = make([]byte, ss.framer.HeaderLen())
+		trailer    = trailerOf(ss.framer)
+		compress   = ss.compressor != nil
+		writeSize  = false
+		vectored   = false
+		corked     = false
+		corkTimer  *time.Timer
+		msg        Message
+		data       []byte
+		length     int
+		wrote      int
+	)
+
+	defer func() {
+		// the message popped but not sent.
+		if msg != nil {
+			msg.Release()
+		}
+	}()
+
+	if compress && ss.framer.Flags()&(FrameCompressed|FrameControl) != FrameCompressed|FrameControl {
+		// compressed frames or the negotiation not supported by framer.
+		ss.notifyEvent(newEventError(newError(ErrorType_SendMessage, ErrFrameFlags)))
+		compress = false
+	}
+	if compress {
+		// advertise the compression to peer before any message.
+		msg = newControlMessage(controlCompress, 0)
+		data = msg.Data()[:msg.Length()]
+		length = len(data)
+	}
+
+	for !ss.isClosed(true) {
+		// no more messages after closing, don't wait.
+		closing := ss.isClosing(true)
+		waitPop := !closing && sendBuffer.Buffered() == 0
+		for sendBuffer.Available() > 0 {
+			if msg == nil {
+				msg = ss.popMessage(waitPop)
+				if msg == nil {
+					break
+				}
+
+				data = msg.Data()[:msg.Length()]
+				length = len(data)
+			}
+
+			waitPop = false
+
+			/* 写消息头 */
+			if !writeSize {
+				if sendBuffer.Available() < len(header) {
+					break
+				}
+
+				var flags FrameFlags
+				if _, ok := msg.(*controlMessage); ok {
+					flags |= FrameControl
+				} else if compress && atomic.LoadInt32(&ss.peerCompress) != 0 {
+					b, err := ss.compress(data)
+					if err != nil {
+						ss.notifyEvent(newEventError(newError(ErrorType_SendMessage, err)))
+					} else if b != nil {
+						data = b
+						flags |= FrameCompressed
+					}
+				}
+				if ss.cipher != nil && len(data)+ss.cipher.Overhead() > maxSizeOf(ss.framer) {
+					// message can not be framed after sealed, drop it before
+					// the nonce used.
+					ss.notifyEvent(newEventError(newError(ErrorType_SendMessage, ErrMsgTooLarge)))
+					msg.Release()
+					msg = nil
+					data = nil
+					continue
+				}
+				if ss.cipher != nil {
+					b, err := ss.cipher.Seal(nil, data)
+					if err != nil {
+						// the message can not be sent securely, close session.
+						ss.notifyEvent(newEventError(newError(ErrorType_Auth, err)))
+						ss.closeWithEvent(CloseReason_AuthFailed)
+						return
+					}
+					data = b
+				}
+				length = len(data)
+				n, err := ss.framer.EncodeHeader(header, data, flags)
+				if err != nil && ss.cipher != nil {
+					// the nonce used by the message not sent, peer can not
+					// open the following messages, close session.
+					ss.notifyEvent(newEventError(newError(ErrorType_Auth, err)))
+					ss.closeWithEvent(CloseReason_AuthFailed)
+					return
+				}
+				if err != nil {
+					// message can not be framed, drop it.
+					ss.notifyEvent(newEventError(newError(ErrorType_SendMessage, err)))
+					msg.Release()
+					msg = nil
+					data = nil
+					continue
+				}
+				sendBuffer.Write(header[:n])
+				writeSize = true
+			}
+
+			/* 写消息 */
+			if wrote == 0 && ss.writevThreshold > 0 && length >= ss.writevThreshold {
+				// large message, written along with the data buffered.
+				vectored = true
+				break
+			}
+			if wrote < length {
+				n, _ := sendBuffer.Write(data[wrote:length])
+				wrote += n
+			}
+			if wrote >= length && len(trailer) > 0 {
+				n, _ := sendBuffer.Write(trailer[wrote-length:])
+				wrote += n
+			}
+			if wrote == length+len(trailer) {
+				writeSize = false
+				ss.sent(msg)
+				msg.Release()
+				msg = nil
+				data = nil
+				length = 0
+				wrote = 0
+			}
+		}
+
+		if ss.flushDelay > 0 && !corked && !closing && !vectored && msg == nil &&
+			sendBuffer.Buffered() > 0 && sendBuffer.Available() > 0 {
+			// cork the send buffer not full, wait for more messages.
+			corked = true
+			if corkTimer == nil {
+				corkTimer = time.NewTimer(ss.flushDelay)
+				defer corkTimer.Stop()
+			} else {
+				corkTimer.Reset(ss.flushDelay)
+			}
+			select {
+			case <-corkTimer.C:
+			case <-ss.closeCh:
+			}
+			continue
+		}
+		corked = false
+
+		/* 发送字节流数据 */
+		if sendBuffer.Buffered() > 0 || vectored {
+			buffered, _ := sendBuffer.Peek(sendBuffer.Buffered())
+			bufs := net.Buffers{buffered}
+			if vectored {
+				bufs = append(bufs, data[:length], trailer)
+			}
+			if !ss.write(bufs) {
+				return
+			}
+			sendBuffer.Discard(len(buffered))
+
+			if vectored {
+				vectored = false
+				writeSize = false
+				ss.sent(msg)
+				msg.Release()
+				msg = nil
+				data = nil
+				length = 0
+			}
+		}
+		sendBuffer.Trim()
+
+		if closing && msg == nil && ss.sendPending() == 0 {
+			// all messages flushed, shut down writing.
+			ss.closeWrite()
+			return
+		}
+	}
+}
+
+// write writes bufs to connection, retries until all written. Returns false
+// if session closed.
+func (ss *streamSession) write(bufs net.Buffers) bool {
+	for len(bufs) > 0 {
+		if ss.sendTimeout > 0 {
+			ss.conn.SetWriteDeadline(time.Now().Add(ss.sendTimeout))
+		}
+
+		n, err := bufs.WriteTo(ss.conn)
+		ss.count(counterBytesSent, int(n))
+		if err != nil {
+			// if session had benn closed, directly return.
+			if ss.isClosed(true) {
+				return false
+			}
+
+			if isConnRST(err) {
+				// close session.
+				ss.Close()
+
+				evt := newEventClose(CloseReason_ConnReset)
+				ss.notifyEvent(evt)
+				return false
+			} else {
+				ss.countError(err)
+				evt := newEventError(newError(ErrorType_SendMessage, err))
+				ss.notifyEvent(evt)
+
+				if !isTimeout(err) {
+					time.Sleep(100 * time.Millisecond)
+				}
+			}
+		}
+	}
+	return true
+}
+
+func (ss *streamSession) receiveThread() {
+	var (
+		trailer       = trailerOf(ss.framer)
+		receiveBuffer = io.NewBinaryBuffer(ss.receiveBufferSize(trailer))
+		reader        = countReader{r: ss.conn, s: &ss.session}
+		msgBytes      []byte
+		msgPooled     bool // 消息数据分配自BytesPool
+		msgSize       = int(-1)
+		msgRead       int
+		discard       bool
+		control       bool
+		compressed    bool
+		trailerLen    int  // 当前消息的尾部长度
+		overflow      bool // 正在丢弃找不到结尾的超长消息
+	)
+
+	if ss.hb.interval > 0 && ss.framer.Flags()&FrameControl == 0 {
+		// heartbeat requires control frames.
+		ss.notifyEvent(newEventError(newError(ErrorType_SendMessage, ErrFrameFlags)))
+		ss.hb.interval = 0
+	}
+	if ss.hb.interval > 0 || ss.hb.idleTimeout > 0 {
+		ss.active()
+		go ss.keepalive()
+	}
+
+	for !ss.isClosed(true) {
+		receiveBuffer.Trim()
+
+		/* 接收字节流数据 */
+		if ss.receiveTimeout > 0 {
+			ss.conn.SetReadDeadline(time.Now().Add(ss.receiveTimeout))
+		}
+
+		// receive network data, the data received in handshake first.
+		if len(ss.pending) > 0 {
+			ss.count(counterBytesReceived, len(ss.pending))
+			receiveBuffer.Write(ss.pending)
+			ss.pending = nil
+		} else if n, err := receiveBuffer.ReadFrom(reader); n == 0 || err != nil {
+			// if session had benn closed, directly return.
+			if ss.isClosed(true) {
+				return
+			}
+
+			ss.countError(err)
+			switch {
+			case n == 0 || isEOF(err):
+				// remote close session, local close too.
+				ss.closeWithEvent(CloseReason_RemoteClose)
+				return
+
+			case isConnRST(err):
+				// connection reset by remote.
+				ss.Close()
+				evt := newEventClose(CloseReason_ConnReset)
+				ss.notifyEvent(evt)
+				return
+
+			default:
+				evt := newEventError(newError(ErrorType_ReceiveMessage, err))
+				ss.notifyEvent(evt)
+
+				if isTimeout(err) {
+					// read timeout, directly retry.
+					continue
+				} else {
+					// other error, sleep a few time.
+					time.Sleep(100 * time.Millisecond)
+				}
+			}
+		} else if discard {
+			// receive a size-exceed message before, discard it's data.
+			discarded, _ := receiveBuffer.Discard(msgSize)
+			msgSize -= discarded
+			if msgSize > 0 {
+				continue
+			}
+			msgSize = -1
+			discard = false
+		}
+
+		for receiveBuffer.Buffered() > 0 {
+			if msgSize < 0 {
+				b, _ := receiveBuffer.Peek(receiveBuffer.Buffered())
+				h, ok, err := ss.framer.DecodeHeader(b)
+				if err != nil {
+					ss.notifyEvent(newEventError(newError(ErrorType_ReceiveMessage, err)))
+					ss.closeWithEvent(CloseReason_ProtocolError)
+					return
+				}
+				if !ok {
+					if len(trailer) > 0 && receiveBuffer.Buffered() >= ss.maxMsgSize+len(trailer) {
+						// the end of message not found in max size, discard the
+						// data except the partial trailer.
+						if !overflow {
+							overflow = true
+							ss.count(counterOversized, 1)
+							ss.notifyEvent(newEventError(newError(ErrorType_ReceiveMessage, ErrMsgTooLarge)))
+						}
+						receiveBuffer.Discard(receiveBuffer.Buffered() - len(trailer) + 1)
+					}
+					break
+				}
+				if overflow {
+					// the rest of size-exceed message.
+					overflow = false
+					receiveBuffer.Discard(h.HeaderLen + h.Size + h.TrailerLen)
+					continue
+				}
+
+				receiveBuffer.Discard(h.HeaderLen)
+				control = h.Flags&FrameControl != 0
+				compressed = h.Flags&FrameCompressed != 0
+				msgSize = h.Size
+				trailerLen = h.TrailerLen
+				if control && (msgSize < controlFrameLen || msgSize > controlFrameLen+ss.cipherOverhead()) {
+					ss.notifyEvent(newEventError(newError(ErrorType_ReceiveMessage, ErrControlFrame)))
+					ss.closeWithEvent(CloseReason_ProtocolError)
+					return
+				}
+				if !control && msgSize > ss.maxMsgSize+ss.cipherOverhead() {
+					// receive a size-exceed message, notify event and discard it's data.
+					ss.count(counterOversized, 1)
+					evt := newEventError(newError(ErrorType_ReceiveMessage, ErrMsgTooLarge))
+					ss.notifyEvent(evt)
+
+					msgSize += trailerLen
+					discarded, _ := receiveBuffer.Discard(msgSize)
+					msgSize -= discarded
+					if msgSize <= 0 {
+						msgSize = -1
+						continue
+					} else {
+						discard = true
+						break
+					}
+				}
+
+				if msgSize > receiveBuffer.Size() {
+					// message size exceed receive buffer size, so alloc a data buffer from pool.
+					msgBytes = BytesPool.Get(msgSize)
+					msgPooled = true
+				}
+			}
+
+			// extract message data.
+			if msgBytes != nil {
+				// read message data from receive buffer.
+				n, _ := receiveBuffer.Read(msgBytes[msgRead:])
+				msgRead += n
+			} else if receiveBuffer.Buffered() >= msgSize {
+				// directly reference bytes of the message of receive buffer.
+				msgBytes, _ = receiveBuffer.Peek(msgSize)
+				receiveBuffer.Discard(msgSize)
+				msgRead = msgSize
+			}
+			if msgRead < msgSize {
+				// partial extract, continue receive data.
+				break
+			}
+
+			if control {
+				// control frame, handled by session itself.
+				if err := ss.receiveControl(msgBytes, msgPooled); err != nil {
+					ss.notifyEvent(newEventError(err))
+					if err.Type() == ErrorType_Auth {
+						ss.closeWithEvent(CloseReason_AuthFailed)
+						return
+					}
+				}
+			} else if msg, err := ss.decodeMessage(msgBytes, msgPooled, compressed); err != nil {
+				// error occur while decoding message.
+				ss.count(counterDecodeErrors, 1)
+				ss.notifyEvent(newEventError(err))
+				if err.Type() == ErrorType_Auth {
+					// message not authenticated, close session.
+					ss.closeWithEvent(CloseReason_AuthFailed)
+					return
+				}
+			} else {
+				// message decoded successfully, notify message up.
+				ss.active()
+				ss.count(counterMessagesReceived, 1)
+				ss.notifyEvent(newEventMessage(msg))
+			}
+
+			// the pooled data buffer released by decoding.
+			msgBytes = nil
+			msgPooled = false
+			msgSize = -1
+			msgRead = 0
+
+			if trailerLen > 0 {
+				// skip the trailer of message.
+				discarded, _ := receiveBuffer.Discard(trailerLen)
+				if discarded < trailerLen {
+					msgSize = trailerLen - discarded
+					discard = true
+					break
+				}
+			}
+		}
+	}
+}
+
+// decodeMessage decrypts, decompresses and decodes the message data received.
+// The data is returned to BytesPool if pooled, unless the ownership
+// transferred to PooledCodecs.
+func (ss *streamSession) decodeMessage(data []byte, pooled, compressed bool) (interface{}, *Error) {
+	if ss.cipher != nil {
+		b, err := ss.open(data)
+		if pooled {
+			BytesPool.Put(data)
+		}
+		if err != nil {
+			return nil, newError(ErrorType_Auth, err)
+		}
+		data, pooled = b, true
+	}
+
+	if compressed {
+		b, err := ss.decompress(data)
+		if pooled {
+			BytesPool.Put(data)
+		}
+		if err != nil {
+			return nil, newError(ErrorType_ReceiveMessage, err)
+		}
+		data, pooled = b, false
+	}
+
+	var (
+		msg interface{}
+		err error
+	)
+	if pc, ok := ss.codecs.(PooledCodecs); ok {
+		if !pooled {
+			b := BytesPool.Get(len(data))
+			copy(b, data)
+			data = b
+		}
+		msg, err = pc.DecodePooled(data)
+	} else {
+		msg, err = ss.codecs.Decode(data)
+		if pooled {
+			BytesPool.Put(data)
+		}
+	}
+	if err != nil {
+		return nil, newError(ErrorType_ReceiveMessage, err)
+	}
+	return msg, nil
+}
+
+// receiveBufferSize returns the size of receive buffer, which holds the
+// header, or the max message along with trailer. The chunks read in raw
+// mode are limited to the max message size.
+func (ss *streamSession) receiveBufferSize(trailer []byte) int {
+	size := maxInt(ss.receiveBuffSize, ss.framer.HeaderLen())
+	if _, ok := ss.framer.(rawFramer); ok {
+		size = minInt(size, ss.maxMsgSize)
+	} else if len(trailer) > 0 {
+		size = maxInt(size, ss.maxMsgSize+len(trailer))
+	}
+	return size
+}
@@ -1,8 +1,13 @@
 package session
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -26,83 +31,84 @@ func (c *tcpCodecs) Encode(o interface{}) (Message, error) {
 }
 
 func (c *tcpCodecs) Decode(bytes []byte) (interface{}, error) {
-	return &stringMsg{msg: bytes}, nil
+	// the data is only valid during the call.
+	return &stringMsg{msg: append([]byte{}, bytes...)}, nil
 }
 
 func Test(t *testing.T) {
 	var (
 		network    = "tcp4"
 		addr       = "127.0.0.1:10000"
-		listener   Listener
 		cliSession Session
-		srvSession Session
-		err        error
 
 		sendMsgCount  = int32(10)
 		clientReceive int32
 		serverReceive int32
-		closed        int32
+		cliClosed     int32
+		srvClosed     int32
+		closed        = make(chan struct{}, 2)
 	)
 
 	// 启动listener
 	fmt.Println("start tcp listener")
-	if listener, err = ListenTCP(network, addr); err != nil {
-		fmt.Printf("create listener failed, %s\n", err)
-		return
+	listener, err := ListenTCP(network, addr)
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
 	}
+	defer listener.Close()
 	go func() {
-		if srvSession, err = listener.Accept(); err == nil {
-			srvSession.SetCodecs(&tcpCodecs{})
-
-			// 启动session
-			srvSession.Start(func(s *session, event Event) {
-				switch event.Type() {
-				case EventType_Message:
-					msg := event.Message().(*stringMsg)
-					atomic.AddInt32(&serverReceive, 1)
-					fmt.Printf("server receive msg len:%d\n", len(msg.msg))
-
-				case EventType_Error:
-					fmt.Printf("server encounter error, %s\n", event.Error().Error())
-
-				case EventType_Close:
-					fmt.Printf("server close, reason: %s\n", event.Reason())
-				}
-			})
-
-			go func() {
-				sendMsgCount := sendMsgCount + 5
-				for i := int32(0); i < sendMsgCount; i++ {
-					srvSession.Send(&stringMsg{msg: make([]byte, 100)})
-				}
-
-				for atomic.LoadInt32(&serverReceive) < sendMsgCount {
-					time.Sleep(1 * time.Millisecond)
-				}
-
-				fmt.Println("server session close")
-				srvSession.Close()
-
-				atomic.AddInt32(&closed, 1)
-			}()
-		} else {
+		srvSession, err := listener.Accept()
+		if err != nil {
 			fmt.Printf("accept session failed, %s\n", err)
+			return
 		}
+		srvSession.SetCodecs(&tcpCodecs{})
+
+		// 启动session
+		srvSession.Start(func(s Session, event Event) {
+			switch event.Type() {
+			case EventType_Message:
+				msg := event.Message().(*stringMsg)
+				atomic.AddInt32(&serverReceive, 1)
+				fmt.Printf("server receive msg len:%d\n", len(msg.msg))
+
+			case EventType_Error:
+				fmt.Printf("server encounter error, %s\n", event.Error().Error())
+
+			case EventType_Close:
+				fmt.Printf("server close, reason: %s\n", event.Reason())
+				atomic.StoreInt32(&srvClosed, 1)
+			}
+		})
+
+		go func() {
+			for i := int32(0); i < sendMsgCount+5; i++ {
+				srvSession.Send(&stringMsg{msg: make([]byte, 100)})
+			}
+
+			// wait for all messages of client, or client closed.
+			for atomic.LoadInt32(&serverReceive) < sendMsgCount && atomic.LoadInt32(&srvClosed) == 0 {
+				time.Sleep(1 * time.Millisecond)
+			}
+
+			fmt.Println("server session close")
+			srvSession.Close()
+			closed <- struct{}{}
+		}()
 	}()
 
 	// 连接server
 	fmt.Println("connect tcp server")
 	if cliSession, err = ConnectTCP(network, addr); err != nil {
-		fmt.Printf("connect server failed, %s\n", err)
-		return
+		t.Fatalf("connect server failed, %s", err)
 	}
 	// 启动client
 	cliSession.SetCodecs(&tcpCodecs{})
-	cliSession.Start(func(s *session, e Event) {
+	cliSession.Start(func(s Session, e Event) {
 		switch e.Type() {
 		case EventType_Message:
 			msg := e.Message().(*stringMsg)
-			atomic.AddInt32(&serverReceive, 1)
+			atomic.AddInt32(&clientReceive, 1)
 			fmt.Printf("client receive msg len:%d\n", len(msg.msg))
 
 		case EventType_Error:
@@ -110,6 +116,7 @@ func Test(t *testing.T) {
 
 		case EventType_Close:
 			fmt.Printf("client close, reason: %s\n", e.Reason())
+			atomic.StoreInt32(&cliClosed, 1)
 		}
 	})
 
@@ -118,18 +125,22 @@ func Test(t *testing.T) {
 			cliSession.Send(&stringMsg{msg: make([]byte, 100)})
 		}
 
-		for atomic.LoadInt32(&clientReceive) < sendMsgCount {
+		// wait for all messages of server, or server closed.
+		for atomic.LoadInt32(&clientReceive) < sendMsgCount+5 && atomic.LoadInt32(&cliClosed) == 0 {
 			time.Sleep(1 * time.Millisecond)
 		}
 
 		fmt.Println("client session close")
 		cliSession.Close()
-
-		atomic.AddInt32(&closed, 1)
+		closed <- struct{}{}
 	}()
 
-	for atomic.LoadInt32(&closed) < 2 {
-		time.Sleep(1 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-closed:
+		case <-time.After(10 * time.Second):
+			t.Fatal("wait sessions closed timeout")
+		}
 	}
 }
 
@@ -139,7 +150,6 @@ func TestMaxMsg(t *testing.T) {
 		addr       = "127.0.0.1:10000"
 		listener   Listener
 		cliSession Session
-		srvSession Session
 		err        error
 
 		maxMsgSize    = 65536
@@ -156,15 +166,16 @@ func TestMaxMsg(t *testing.T) {
 		fmt.Printf("create listener failed, %s\n", err)
 		return
 	}
+	defer listener.Close()
 	go func() {
-		if srvSession, err = listener.Accept(); err == nil {
+		if srvSession, err := listener.Accept(); err == nil {
 			srvSession.SetCodecs(&tcpCodecs{})
 			srvSession.SetSendBuffer(8192)
 			srvSession.SetReceiveBuffer(8192)
 			srvSession.SetMaxMessage(maxMsgSize)
 
 			// 启动session
-			srvSession.Start(func(s *session, e Event) {
+			srvSession.Start(func(s Session, e Event) {
 				switch e.Type() {
 				case EventType_Error:
 					fmt.Printf("server encounter error, %s\n", e.Error().Error())
@@ -208,7 +219,7 @@ func TestMaxMsg(t *testing.T) {
 	cliSession.SetSendBuffer(8192)
 	cliSession.SetReceiveBuffer(8192)
 	cliSession.SetMaxMessage(maxMsgSize)
-	cliSession.Start(func(s *session, evt Event) {
+	cliSession.Start(func(s Session, evt Event) {
 		switch evt.Type() {
 		case EventType_Error:
 			fmt.Printf("client encounter error, %s\n", evt.Error().Error())
@@ -241,3 +252,550 @@ func TestMaxMsg(t *testing.T) {
 		time.Sleep(1 * time.Millisecond)
 	}
 }
+
+func TestCloseGracefully(t *testing.T) {
+	listener, err := ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	var (
+		sendMsgCount  = 1000
+		serverReceive int32
+		srvReason     = make(chan string, 1)
+	)
+	go func() {
+		srvSession, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		srvSession.SetCodecs(&tcpCodecs{})
+		srvSession.Start(func(s Session, e Event) {
+			switch e.Type() {
+			case EventType_Message:
+				atomic.AddInt32(&serverReceive, 1)
+			case EventType_Close:
+				srvReason <- e.Reason()
+			}
+		})
+	}()
+
+	cliSession, err := ConnectTCP("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	var (
+		cliCloseCount int32
+		cliReason     atomic.Value
+	)
+	cliSession.SetCodecs(&tcpCodecs{})
+	cliSession.SetSendQueue(sendMsgCount)
+	cliSession.Start(func(s Session, e Event) {
+		if e.Type() == EventType_Close {
+			atomic.AddInt32(&cliCloseCount, 1)
+			cliReason.Store(e.Reason())
+		}
+	})
+
+	for i := 0; i < sendMsgCount; i++ {
+		if err := cliSession.Send(&stringMsg{msg: make([]byte, 1000)}); err != nil {
+			t.Fatalf("send failed, %s", err)
+		}
+	}
+
+	// messages queued before closing are all delivered.
+	if err := cliSession.CloseGracefully(5 * time.Second); err != nil {
+		t.Fatalf("close gracefully failed, %s", err)
+	}
+	if n := atomic.LoadInt32(&serverReceive); n != int32(sendMsgCount) {
+		t.Fatalf("server receive %d", n)
+	}
+	if r := <-srvReason; r != CloseReason_RemoteClose {
+		t.Fatalf("server close reason %q", r)
+	}
+	if n := atomic.LoadInt32(&cliCloseCount); n != 1 {
+		t.Fatalf("client close %d times", n)
+	}
+	if r := cliReason.Load(); r != CloseReason_LocalGracefulClose {
+		t.Fatalf("client close reason %q", r)
+	}
+	if err := cliSession.Send(&stringMsg{msg: make([]byte, 10)}); err != ErrSessionClosed {
+		t.Fatalf("send after close returns %v", err)
+	}
+}
+
+func TestCloseGracefullyTimeout(t *testing.T) {
+	listener, err := ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	// the peer never closes.
+	accepted := make(chan Session, 1)
+	go func() {
+		srvSession, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		accepted <- srvSession
+	}()
+
+	cliSession, err := ConnectTCP("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	cliReason := make(chan string, 2)
+	cliSession.SetCodecs(&tcpCodecs{})
+	cliSession.Start(func(s Session, e Event) {
+		if e.Type() == EventType_Close {
+			cliReason <- e.Reason()
+		}
+	})
+	defer (<-accepted).(*TCPSession).conn.Close()
+
+	if err := cliSession.CloseGracefully(100 * time.Millisecond); err != ErrCloseTimeout {
+		t.Fatalf("close gracefully returns %v", err)
+	}
+	if r := <-cliReason; r != CloseReason_LocalGracefulClose {
+		t.Fatalf("client close reason %q", r)
+	}
+	select {
+	case r := <-cliReason:
+		t.Fatalf("client close again, reason %q", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	listener, err := ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	srvReason := make(chan string, 1)
+	go func() {
+		srvSession, err := listener.AcceptTCP()
+		if err != nil {
+			return
+		}
+		srvSession.SetCodecs(&tcpCodecs{})
+		srvSession.SetIdleTimeout(200 * time.Millisecond)
+		srvSession.Start(func(s Session, e Event) {
+			if e.Type() == EventType_Close {
+				srvReason <- e.Reason()
+			}
+		})
+	}()
+
+	cliSession, err := ConnectTCP("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	cliReason := make(chan string, 1)
+	cliSession.SetCodecs(&tcpCodecs{})
+	if err := cliSession.SetHeartbeat(10*time.Millisecond, 0, 3); err != nil {
+		t.Fatalf("set heartbeat failed, %s", err)
+	}
+	cliSession.Start(func(s Session, e Event) {
+		switch e.Type() {
+		case EventType_Message:
+			t.Errorf("control frame passed to codecs")
+		case EventType_Close:
+			cliReason <- e.Reason()
+		}
+	})
+
+	waitFor(t, func() bool { return cliSession.RTT() > 0 }, "rtt not measured")
+
+	// heartbeat does not keep session active.
+	select {
+	case r := <-srvReason:
+		if r != CloseReason_IdleTimeout {
+			t.Fatalf("server close reason %q", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait idle timeout")
+	}
+	if r := <-cliReason; r != CloseReason_RemoteClose {
+		t.Fatalf("client close reason %q", r)
+	}
+}
+
+func TestHeartbeatTimeout(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer l.Close()
+
+	// peer never replies pong.
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		ioutil.ReadAll(conn)
+	}()
+
+	cliSession, err := ConnectTCP("tcp4", l.Addr().String())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	cliReason := make(chan string, 1)
+	cliSession.SetCodecs(&tcpCodecs{})
+	cliSession.SetHeartbeat(10*time.Millisecond, 20*time.Millisecond, 3)
+	cliSession.Start(func(s Session, e Event) {
+		if e.Type() == EventType_Close {
+			cliReason <- e.Reason()
+		}
+	})
+
+	select {
+	case r := <-cliReason:
+		if r != CloseReason_HeartbeatTimeout {
+			t.Fatalf("client close reason %q", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait heartbeat timeout")
+	}
+}
+
+func TestWritev(t *testing.T) {
+	for _, framer := range []Framer{DefaultFramer, NewDelimiterFramer([]byte("\r\n"))} {
+		testWritev(t, framer)
+	}
+}
+
+func testWritev(t *testing.T, framer Framer) {
+	listener, err := ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	received := make(chan []byte, 10)
+	go func() {
+		srvSession, err := listener.AcceptTCP()
+		if err != nil {
+			return
+		}
+		srvSession.SetCodecs(&tcpCodecs{})
+		srvSession.SetFramer(framer)
+		srvSession.SetMaxMessage(1 << 20)
+		srvSession.Start(func(s Session, e Event) {
+			if e.Type() == EventType_Message {
+				received <- append([]byte(nil), e.Message().(*stringMsg).msg...)
+			}
+		})
+	}()
+
+	cliSession, err := ConnectTCP("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	defer cliSession.Close()
+
+	cliSession.SetCodecs(&tcpCodecs{})
+	cliSession.SetFramer(framer)
+	cliSession.SetMaxMessage(1 << 20)
+	cliSession.SetSendBuffer(256)
+	if err := cliSession.SetWritevThreshold(-1); err != ErrBuffSize {
+		t.Fatalf("set negative threshold, %v", err)
+	}
+	cliSession.SetWritevThreshold(100)
+	cliSession.Start(func(s Session, e Event) {})
+
+	// small messages copied to send buffer and large ones written directly.
+	var msgs [][]byte
+	for i, size := range []int{10, 100, 50, 1000, 99, 1 << 20, 1} {
+		msg := make([]byte, size)
+		for j := range msg {
+			msg[j] = byte('a' + (i+j)%26)
+		}
+		msgs = append(msgs, msg)
+		cliSession.Send(&stringMsg{msg: msg})
+	}
+	for _, msg := range msgs {
+		select {
+		case b := <-received:
+			if !bytes.Equal(b, msg) {
+				t.Fatalf("%T: receive msg len %d, expected %d", framer, len(b), len(msg))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%T: wait message timeout", framer)
+		}
+	}
+}
+
+func TestSendOverflow(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer l.Close()
+
+	// peer never reads.
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	for _, policy := range []OverflowPolicy{
+		OverflowPolicy_DropNewest,
+		OverflowPolicy_DropOldest,
+		OverflowPolicy_CloseSession,
+	} {
+		events := make(chan Event, 10)
+		s, err := ConnectTCP("tcp4", l.Addr().String())
+		if err != nil {
+			t.Fatalf("connect server failed, %s", err)
+		}
+		s.SetCodecs(&tcpCodecs{})
+		s.SetSendQueue(1)
+		if err := s.SetOverflowPolicy(OverflowPolicy(9)); err != ErrOverflowPolicy {
+			t.Fatalf("set invalid overflow policy, %v", err)
+		}
+		s.SetOverflowPolicy(policy)
+		s.Start(func(s Session, e Event) { events <- e })
+
+		// fill the socket buffer and send queue, until the queue keeps full.
+		msg := &stringMsg{msg: make([]byte, 60000)}
+		deadline := time.Now().Add(5 * time.Second)
+		for full := 0; full < 3; {
+			if time.Now().After(deadline) {
+				t.Fatal("send queue never full")
+			}
+			if s.TrySend(msg) == ErrSendQueueFull {
+				full++
+				time.Sleep(20 * time.Millisecond)
+			} else {
+				full = 0
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		if err := s.SendContext(ctx, msg); err != context.DeadlineExceeded {
+			t.Fatalf("send with context, %v", err)
+		}
+		cancel()
+
+		err = s.Send(msg)
+		switch policy {
+		case OverflowPolicy_DropOldest:
+			if err != nil {
+				t.Fatalf("policy %d: send %v", policy, err)
+			}
+		default:
+			if err != ErrSendQueueFull {
+				t.Fatalf("policy %d: send %v", policy, err)
+			}
+		}
+
+		if e := waitEvent(t, events, EventType_Error); e.Error().Type() != ErrorType_QueueOverflow {
+			t.Fatalf("policy %d: error %s", policy, e.Error())
+		}
+		if policy == OverflowPolicy_CloseSession {
+			if e := waitEvent(t, events, EventType_Close); e.Reason() != CloseReason_QueueOverflow {
+				t.Fatalf("close reason %s", e.Reason())
+			}
+		} else {
+			s.Close()
+		}
+	}
+}
+
+func TestSendWhileClose(t *testing.T) {
+	listener, err := ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			srvSession, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			srvSession.SetCodecs(&tcpCodecs{})
+			srvSession.Start(func(s Session, e Event) {})
+		}
+	}()
+
+	for _, qt := range []QueueType{QueueType_Ring, QueueType_Linked, QueueType_Chan} {
+		s, err := ConnectTCP("tcp4", listener.Addr())
+		if err != nil {
+			t.Fatalf("connect server failed, %s", err)
+		}
+		s.SetCodecs(&tcpCodecs{})
+		if err := s.SetSendQueueType(QueueType(9)); err != ErrQueueType {
+			t.Fatalf("set invalid send queue type, %v", err)
+		}
+		s.SetSendQueueType(qt)
+		s.SetSendQueue(4)
+		s.Start(func(s Session, e Event) {})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					err := s.Send(&stringMsg{msg: make([]byte, 100)})
+					if err == ErrSessionClosed {
+						return
+					}
+					if err != nil {
+						t.Errorf("queue type %d: send %v", qt, err)
+						return
+					}
+				}
+			}()
+		}
+		time.Sleep(20 * time.Millisecond)
+		s.Close()
+		wg.Wait()
+	}
+}
+
+// releaseCodecs counts the messages encoded and released.
+type releaseCodecs struct {
+	tcpCodecs
+	encoded  int32
+	released int32
+}
+
+type releaseMessage struct {
+	Message
+	c *releaseCodecs
+}
+
+func (m *releaseMessage) Release() { atomic.AddInt32(&m.c.released, 1) }
+
+func (c *releaseCodecs) Encode(o interface{}) (Message, error) {
+	m, err := c.tcpCodecs.Encode(o)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt32(&c.encoded, 1)
+	return &releaseMessage{Message: m, c: c}, nil
+}
+
+func TestReleaseOnClose(t *testing.T) {
+	listener, err := ListenTCP("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	// the server never reads.
+	accepted := make(chan *TCPSession, 1)
+	go func() {
+		srvSession, err := listener.AcceptTCP()
+		if err != nil {
+			return
+		}
+		accepted <- srvSession
+	}()
+
+	s, err := ConnectTCP("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	defer (<-accepted).discard()
+
+	codecs := &releaseCodecs{}
+	s.SetCodecs(codecs)
+	s.SetSendQueue(1000)
+	s.Start(func(s Session, e Event) {})
+	for i := 0; i < 500; i++ {
+		if err := s.Send(&stringMsg{msg: make([]byte, 1<<16)}); err != nil {
+			t.Fatalf("send failed, %v", err)
+		}
+	}
+
+	// wait until the sending blocked.
+	for n := -1; n != s.Stats().SendQueueLen; {
+		n = s.Stats().SendQueueLen
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// the messages queued, popped and being written are released, along
+	// with the wake-up of closing queued.
+	if err := s.CloseGracefully(200 * time.Millisecond); err != ErrCloseTimeout {
+		t.Fatalf("close gracefully returns %v", err)
+	}
+	waitFor(t, func() bool { return atomic.LoadInt32(&codecs.released) == 500 },
+		"released %d of %d", atomic.LoadInt32(&codecs.released), atomic.LoadInt32(&codecs.encoded))
+}
+
+func TestFlushDelay(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer l.Close()
+
+	const msgCount, msgSize = 10, 10
+	type read struct {
+		n  int
+		at time.Time
+	}
+	reads := make(chan read, msgCount)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		b := make([]byte, 4096)
+		for {
+			n, err := conn.Read(b)
+			if err != nil {
+				return
+			}
+			reads <- read{n: n, at: time.Now()}
+		}
+	}()
+
+	s, err := ConnectTCP("tcp4", l.Addr().String())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	defer s.Close()
+
+	s.SetCodecs(&tcpCodecs{})
+	if err := s.SetFlushDelay(-1); err != ErrFlushDelay {
+		t.Fatalf("set negative flush delay, %v", err)
+	}
+	delay := 200 * time.Millisecond
+	s.SetFlushDelay(delay)
+	s.Start(func(s Session, e Event) {})
+
+	// the messages sent during the delay are written at once.
+	start := time.Now()
+	for i := 0; i < msgCount; i++ {
+		s.Send(&stringMsg{msg: make([]byte, msgSize)})
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case r := <-reads:
+		if r.n != msgCount*(msgSize+4) {
+			t.Fatalf("read %d bytes at once", r.n)
+		}
+		if r.at.Sub(start) < delay/2 {
+			t.Fatalf("written after %s", r.at.Sub(start))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait data timeout")
+	}
+}
@@ -0,0 +1,145 @@
+package session
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// TLSDefaultHandshakeTimeout is the default timeout of the TLS handshake.
+const TLSDefaultHandshakeTimeout = 10 * time.Second
+
+// TLSSession is a TLS-secured stream session. It uses the same length-prefixed
+// message framing as TCPSession.
+type TLSSession struct {
+	streamSession
+	handshakeTimeout time.Duration // 握手超时
+}
+
+func newTlsSession(conn *tls.Conn) *TLSSession {
+	s := &TLSSession{handshakeTimeout: TLSDefaultHandshakeTimeout}
+	s.streamSession = newStreamSession(s, conn)
+	return s
+}
+
+func (s *TLSSession) tlsConn() *tls.Conn { return s.conn.(*tls.Conn) }
+
+// SetHandshakeTimeout set the timeout of TLS handshake, before session started.
+// Zero means no timeout.
+func (s *TLSSession) SetHandshakeTimeout(t time.Duration) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.isStarted(false) {
+		return ErrSessionStarted
+	}
+	if s.isClosed(false) {
+		return ErrSessionClosed
+	}
+
+	s.handshakeTimeout = t
+	return nil
+}
+
+// ConnectionState returns the negotiated TLS connection state. It is
+// meaningful only after the handshake completed.
+func (s *TLSSession) ConnectionState() tls.ConnectionState {
+	return s.tlsConn().ConnectionState()
+}
+
+// handshake runs the TLS handshake if it has not yet been run.
+func (s *TLSSession) handshake() error {
+	conn := s.tlsConn()
+	if s.handshakeTimeout > 0 {
+		conn.SetDeadline(time.Now().Add(s.handshakeTimeout))
+		defer conn.SetDeadline(time.Time{})
+	}
+	return conn.Handshake()
+}
+
+type TLSListener struct {
+	stats  listenerStats // 会话统计
+	l      *net.TCPListener
+	config *tls.Config
+}
+
+func (l *TLSListener) Accept() (s Session, e error) {
+	return l.AcceptTLS()
+}
+
+// AcceptTLS waits for the next connection and returns the TLS session. The
+// handshake is deferred until the session started, so that slow peers could
+// not block the listener.
+func (l *TLSListener) AcceptTLS() (s *TLSSession, e error) {
+	if conn, err := l.l.AcceptTCP(); err == nil {
+		s, e = newTlsSession(tls.Server(conn, l.config)), nil
+		l.stats.accept(s)
+	} else {
+		e = err
+	}
+
+	return
+}
+
+func (l *TLSListener) Close() error {
+	return l.l.Close()
+}
+
+func (l *TLSListener) Network() string {
+	return l.l.Addr().Network()
+}
+
+func (l *TLSListener) Addr() string {
+	return l.l.Addr().String()
+}
+
+func (l *TLSListener) Stats() ListenerStats {
+	return l.stats.load()
+}
+
+func ListenTLS(network, addr string, config *tls.Config) (*TLSListener, error) {
+	if config == nil {
+		return nil, ErrNilTLSConfig
+	}
+
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		if addr, err := net.ResolveTCPAddr(network, addr); err != nil {
+			return nil, err
+		} else if l, err := net.ListenTCP(network, addr); err != nil {
+			return nil, err
+		} else {
+			return &TLSListener{l: l, config: config}, nil
+		}
+
+	default:
+		return nil, ErrUnknownNetwork
+	}
+}
+
+func ConnectTLS(network, addr string, config *tls.Config) (*TLSSession, error) {
+	return ConnectTLSTimeout(network, addr, config, 0)
+}
+
+// ConnectTLSTimeout connects to the address and performs the TLS handshake,
+// the timeout covers both. The handshake error returned as is.
+func ConnectTLSTimeout(network, addr string, config *tls.Config, timeout time.Duration) (s *TLSSession, e error) {
+	if config == nil {
+		return nil, ErrNilTLSConfig
+	}
+
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		dialer := &net.Dialer{Timeout: timeout}
+		if conn, err := tls.DialWithDialer(dialer, network, addr, config); err == nil {
+			s = newTlsSession(conn)
+		} else {
+			e = err
+		}
+
+	default:
+		e = ErrUnknownNetwork
+	}
+
+	return
+}
@@ -0,0 +1,165 @@
+package session
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestTLSConfig generate a self-signed certificate for 127.0.0.1 and returns
+// the server config and a client config trusting it.
+func newTestTLSConfig(t *testing.T) (*tls.Config, *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "go-net test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	srvConfig := &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}
+	cliConfig := &tls.Config{RootCAs: pool}
+	return srvConfig, cliConfig
+}
+
+func TestTLS(t *testing.T) {
+	srvConfig, cliConfig := newTestTLSConfig(t)
+
+	listener, err := ListenTLS("tcp4", "127.0.0.1:0", srvConfig)
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	var (
+		sendMsgCount  = int32(10)
+		serverReceive int32
+		clientReceive int32
+	)
+
+	go func() {
+		srvSession, err := listener.AcceptTLS()
+		if err != nil {
+			return
+		}
+		srvSession.SetCodecs(&tcpCodecs{})
+		srvSession.Start(func(s Session, e Event) {
+			if e.Type() == EventType_Message {
+				atomic.AddInt32(&serverReceive, 1)
+				s.Send(e.Message())
+			}
+		})
+	}()
+
+	cliSession, err := ConnectTLSTimeout("tcp4", listener.Addr(), cliConfig, time.Second)
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	if !cliSession.ConnectionState().HandshakeComplete {
+		t.Fatal("handshake not complete")
+	}
+	cliSession.SetCodecs(&tcpCodecs{})
+	cliSession.Start(func(s Session, e Event) {
+		if e.Type() == EventType_Message {
+			atomic.AddInt32(&clientReceive, 1)
+		}
+	})
+	defer cliSession.Close()
+
+	for i := int32(0); i < sendMsgCount; i++ {
+		cliSession.Send(&stringMsg{msg: make([]byte, 100)})
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&clientReceive) < sendMsgCount {
+		if time.Now().After(deadline) {
+			t.Fatalf("server receive %d, client receive %d", atomic.LoadInt32(&serverReceive), atomic.LoadInt32(&clientReceive))
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+}
+
+func TestTLSHandshakeFailed(t *testing.T) {
+	srvConfig, _ := newTestTLSConfig(t)
+
+	listener, err := ListenTLS("tcp4", "127.0.0.1:0", srvConfig)
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	var (
+		errType = make(chan ErrorType, 1)
+		reason  = make(chan string, 1)
+	)
+
+	go func() {
+		srvSession, err := listener.AcceptTLS()
+		if err != nil {
+			return
+		}
+		srvSession.SetCodecs(&tcpCodecs{})
+		srvSession.Start(func(s Session, e Event) {
+			switch e.Type() {
+			case EventType_Error:
+				errType <- e.Error().Type()
+			case EventType_Close:
+				reason <- e.Reason()
+			}
+		})
+	}()
+
+	// client does not trust the certificate of server.
+	if _, err := ConnectTLSTimeout("tcp4", listener.Addr(), &tls.Config{}, time.Second); err == nil {
+		t.Fatal("connect with untrusted certificate succeed")
+	}
+
+	select {
+	case et := <-errType:
+		if et != ErrorType_Handshake {
+			t.Fatalf("error type %s, expected %s", et, ErrorType_Handshake)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait handshake error timeout")
+	}
+
+	select {
+	case r := <-reason:
+		if r != CloseReason_HandshakeFailed {
+			t.Fatalf("close reason %q, expected %q", r, CloseReason_HandshakeFailed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait close timeout")
+	}
+}
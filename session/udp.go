@@ -0,0 +1,312 @@
+package session
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	UDPMaxMsgSize        = 65507
+	UDPDefaultMaxMsgSize = UDPMaxMsgSize
+
+	// UDPAcceptBacklog is the number of new peers waiting to be accepted,
+	// packets from more new peers will be dropped.
+	UDPAcceptBacklog = 128
+
+	// UDPPeerQueueSize is the number of packets of a peer waiting to be read,
+	// packets exceed will be dropped.
+	UDPPeerQueueSize = 64
+)
+
+// UDPSession is a datagram session. Each datagram carries exactly one message.
+type UDPSession struct {
+	packetSession
+}
+
+func newUdpSession(conn net.Conn) *UDPSession {
+	s := &UDPSession{}
+	s.packetSession = newPacketSession(s, conn, UDPDefaultMaxMsgSize)
+	return s
+}
+
+func (udp *UDPSession) SetMaxMessage(size int) error {
+	if size <= 0 || size > UDPMaxMsgSize {
+		return ErrMaxMsgSize
+	}
+	return udp.session.SetMaxMessage(size)
+}
+
+// UDPListener reads datagrams from a UDP socket and demultiplexes them by
+// the remote address into virtual sessions, a new session will be accepted
+// when datagram arrives from an unknown remote address.
+type UDPListener struct {
+	stats listenerStats // 会话统计
+	mux   *udpMux
+}
+
+func (l *UDPListener) Accept() (Session, error) {
+	return l.AcceptUDP()
+}
+
+func (l *UDPListener) AcceptUDP() (*UDPSession, error) {
+	if p, err := l.mux.accept(); err != nil {
+		return nil, err
+	} else {
+		s := newUdpSession(p)
+		l.stats.accept(s)
+		return s, nil
+	}
+}
+
+// Close the listener and all the sessions accepted from it.
+func (l *UDPListener) Close() error {
+	return l.mux.close()
+}
+
+func (l *UDPListener) Network() string {
+	return l.mux.conn.LocalAddr().Network()
+}
+
+func (l *UDPListener) Addr() string {
+	return l.mux.conn.LocalAddr().String()
+}
+
+func (l *UDPListener) Stats() ListenerStats {
+	return l.stats.load()
+}
+
+func ListenUDP(network, addr string) (*UDPListener, error) {
+	if mux, err := listenUdpMux(network, addr); err != nil {
+		return nil, err
+	} else {
+		return &UDPListener{mux: mux}, nil
+	}
+}
+
+func ConnectUDP(network, addr string) (*UDPSession, error) {
+	return ConnectUDPTimeout(network, addr, 0)
+}
+
+func ConnectUDPTimeout(network, addr string, timeout time.Duration) (s *UDPSession, e error) {
+	switch network {
+	case "udp", "udp4", "udp6":
+		if conn, err := net.DialTimeout(network, addr, timeout); err == nil {
+			s = newUdpSession(conn)
+		} else {
+			e = err
+		}
+
+	default:
+		e = ErrUnknownNetwork
+	}
+
+	return
+}
+
+// udpMux reads datagrams from a UDP socket and demultiplexes them by the
+// remote address into virtual connections.
+type udpMux struct {
+	conn     *net.UDPConn
+	mtx      sync.Mutex
+	peers    map[string]*udpPeerConn
+	acceptCh chan *udpPeerConn
+	closed   chan struct{}
+}
+
+func listenUdpMux(network, addr string) (*udpMux, error) {
+	switch network {
+	case "udp", "udp4", "udp6":
+		if addr, err := net.ResolveUDPAddr(network, addr); err != nil {
+			return nil, err
+		} else if conn, err := net.ListenUDP(network, addr); err != nil {
+			return nil, err
+		} else {
+			m := &udpMux{
+				conn:     conn,
+				peers:    make(map[string]*udpPeerConn),
+				acceptCh: make(chan *udpPeerConn, UDPAcceptBacklog),
+				closed:   make(chan struct{}),
+			}
+			go m.readLoop()
+			return m, nil
+		}
+
+	default:
+		return nil, ErrUnknownNetwork
+	}
+}
+
+func (m *udpMux) accept() (*udpPeerConn, error) {
+	select {
+	case p := <-m.acceptCh:
+		return p, nil
+	case <-m.closed:
+		return nil, ErrListenerClosed
+	}
+}
+
+// close the socket and all the virtual connections.
+func (m *udpMux) close() error {
+	m.mtx.Lock()
+	select {
+	case <-m.closed:
+		m.mtx.Unlock()
+		return ErrListenerClosed
+	default:
+	}
+	close(m.closed)
+	peers := m.peers
+	m.peers = nil
+	m.mtx.Unlock()
+
+	for _, p := range peers {
+		p.close(ErrListenerClosed)
+	}
+	return m.conn.Close()
+}
+
+func (m *udpMux) readLoop() {
+	buf := make([]byte, UDPMaxMsgSize+1)
+	for {
+		n, addr, err := m.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-m.closed:
+				return
+			default:
+			}
+
+			if !isTimeout(err) {
+				time.Sleep(100 * time.Millisecond)
+			}
+			continue
+		}
+
+		key := addr.String()
+		m.mtx.Lock()
+		if m.peers == nil {
+			m.mtx.Unlock()
+			return
+		}
+		p, ok := m.peers[key]
+		if !ok {
+			p = newUdpPeerConn(m, addr)
+			select {
+			case m.acceptCh <- p:
+				m.peers[key] = p
+			default:
+				// accept backlog is full, drop the packet.
+				p = nil
+			}
+		}
+		m.mtx.Unlock()
+
+		if p != nil {
+			packet := make([]byte, n)
+			copy(packet, buf[:n])
+			p.push(packet)
+		}
+	}
+}
+
+func (m *udpMux) removePeer(p *udpPeerConn) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.peers != nil && m.peers[p.raddr.String()] == p {
+		delete(m.peers, p.raddr.String())
+	}
+}
+
+// udpPeerConn is the virtual connection of remote peer of udpMux.
+type udpPeerConn struct {
+	m        *udpMux
+	raddr    *net.UDPAddr
+	packets  chan []byte
+	mtx      sync.Mutex
+	deadline time.Time
+	closeErr error
+	closed   chan struct{}
+}
+
+func newUdpPeerConn(m *udpMux, raddr *net.UDPAddr) *udpPeerConn {
+	return &udpPeerConn{
+		m:       m,
+		raddr:   raddr,
+		packets: make(chan []byte, UDPPeerQueueSize),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (c *udpPeerConn) push(packet []byte) {
+	select {
+	case c.packets <- packet:
+	default:
+		// peer queue is full, drop the packet.
+	}
+}
+
+func (c *udpPeerConn) Read(b []byte) (int, error) {
+	c.mtx.Lock()
+	deadline := c.deadline
+	c.mtx.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case packet := <-c.packets:
+		return copy(b, packet), nil
+	case <-timeout:
+		return 0, errTimeout
+	case <-c.closed:
+		return 0, c.closeErr
+	}
+}
+
+func (c *udpPeerConn) Write(b []byte) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, c.closeErr
+	default:
+	}
+	return c.m.conn.WriteToUDP(b, c.raddr)
+}
+
+func (c *udpPeerConn) close(err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	select {
+	case <-c.closed:
+	default:
+		c.closeErr = err
+		close(c.closed)
+	}
+}
+
+func (c *udpPeerConn) Close() error {
+	c.close(ErrConnClosed)
+	c.m.removePeer(c)
+	return nil
+}
+
+func (c *udpPeerConn) LocalAddr() net.Addr  { return c.m.conn.LocalAddr() }
+func (c *udpPeerConn) RemoteAddr() net.Addr { return c.raddr }
+
+func (c *udpPeerConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *udpPeerConn) SetReadDeadline(t time.Time) error {
+	c.mtx.Lock()
+	c.deadline = t
+	c.mtx.Unlock()
+	return nil
+}
+
+// SetWriteDeadline does nothing, writing to UDP socket does not block.
+func (c *udpPeerConn) SetWriteDeadline(t time.Time) error { return nil }
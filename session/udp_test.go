@@ -0,0 +1,75 @@
+package session
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUDP(t *testing.T) {
+	listener, err := ListenUDP("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+
+	var (
+		sendMsgCount  = int32(10)
+		clientReceive int32
+		srvReason     = make(chan string, 1)
+	)
+
+	go func() {
+		srvSession, err := listener.AcceptUDP()
+		if err != nil {
+			return
+		}
+		srvSession.SetCodecs(&tcpCodecs{})
+		srvSession.Start(func(s Session, e Event) {
+			switch e.Type() {
+			case EventType_Message:
+				s.Send(e.Message())
+			case EventType_Close:
+				srvReason <- e.Reason()
+			}
+		})
+	}()
+
+	cliSession, err := ConnectUDP("udp4", listener.Addr())
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	cliSession.SetCodecs(&tcpCodecs{})
+	cliSession.Start(func(s Session, e Event) {
+		if e.Type() == EventType_Message {
+			if len(e.Message().(*stringMsg).msg) != 100 {
+				t.Errorf("receive msg len %d", len(e.Message().(*stringMsg).msg))
+			}
+			atomic.AddInt32(&clientReceive, 1)
+		}
+	})
+	defer cliSession.Close()
+
+	if err := cliSession.Send(&stringMsg{msg: make([]byte, UDPMaxMsgSize+1)}); err != ErrMsgTooLarge {
+		t.Fatalf("send size-exceed message, %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&clientReceive) < sendMsgCount {
+		if time.Now().After(deadline) {
+			t.Fatalf("client receive %d", atomic.LoadInt32(&clientReceive))
+		}
+		// datagrams may be lost, keep sending.
+		cliSession.Send(&stringMsg{msg: make([]byte, 100)})
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	listener.Close()
+	select {
+	case r := <-srvReason:
+		if r != CloseReason_ListenerClosed {
+			t.Fatalf("close reason %q, expected %q", r, CloseReason_ListenerClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait close timeout")
+	}
+}
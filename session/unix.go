@@ -0,0 +1,116 @@
+package session
+
+import (
+	"net"
+	"time"
+)
+
+const (
+	UnixPacketDefaultMaxMsgSize = 65536
+
+	// UnixMaxFiles is the max number of files passed along with a message.
+	UnixMaxFiles = 16
+)
+
+// UnixSession is a session over "unix" stream socket. It uses the same
+// length-prefixed message framing as TCPSession.
+type UnixSession struct {
+	streamSession
+}
+
+func newUnixSession(conn *net.UnixConn) *UnixSession {
+	s := &UnixSession{}
+	s.streamSession = newStreamSession(s, conn)
+	return s
+}
+
+// UnixPacketSession is a session over "unixpacket" socket. Each packet carries
+// exactly one message, the files of FileMessage are passed along with it.
+type UnixPacketSession struct {
+	packetSession
+}
+
+func newUnixPacketSession(conn *net.UnixConn) *UnixPacketSession {
+	s := &UnixPacketSession{}
+	s.packetSession = newPacketSession(s, conn, UnixPacketDefaultMaxMsgSize)
+	return s
+}
+
+func newUnixSessionOf(network string, conn *net.UnixConn) Session {
+	if network == "unixpacket" {
+		return newUnixPacketSession(conn)
+	}
+	return newUnixSession(conn)
+}
+
+type UnixListener struct {
+	stats listenerStats // 会话统计
+	l     *net.UnixListener
+}
+
+// Accept waits for the next connection, returns *UnixSession if the network
+// is "unix", or *UnixPacketSession if "unixpacket".
+func (l *UnixListener) Accept() (s Session, e error) {
+	if conn, err := l.l.AcceptUnix(); err == nil {
+		s, e = newUnixSessionOf(l.Network(), conn), nil
+		l.stats.accept(s)
+	} else {
+		e = err
+	}
+
+	return
+}
+
+func (l *UnixListener) Close() error {
+	return l.l.Close()
+}
+
+func (l *UnixListener) Network() string {
+	return l.l.Addr().Network()
+}
+
+func (l *UnixListener) Addr() string {
+	return l.l.Addr().String()
+}
+
+func (l *UnixListener) Stats() ListenerStats {
+	return l.stats.load()
+}
+
+func ListenUnix(network, addr string) (*UnixListener, error) {
+	switch network {
+	case "unix", "unixpacket":
+		if addr, err := net.ResolveUnixAddr(network, addr); err != nil {
+			return nil, err
+		} else if l, err := net.ListenUnix(network, addr); err != nil {
+			return nil, err
+		} else {
+			return &UnixListener{l: l}, nil
+		}
+
+	default:
+		return nil, ErrUnknownNetwork
+	}
+}
+
+func ConnectUnix(network, addr string) (Session, error) {
+	return ConnectUnixTimeout(network, addr, 0)
+}
+
+// ConnectUnixTimeout connects to the address, returns *UnixSession if the
+// network is "unix", or *UnixPacketSession if "unixpacket".
+func ConnectUnixTimeout(network, addr string, timeout time.Duration) (s Session, e error) {
+	switch network {
+	case "unix", "unixpacket":
+		if conn, err := net.DialTimeout(network, addr, timeout); err == nil {
+			s = newUnixSessionOf(network, conn.(*net.UnixConn))
+		} else {
+			e = err
+		}
+
+	default:
+		e = ErrUnknownNetwork
+	}
+
+	return
+}
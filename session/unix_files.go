@@ -0,0 +1,58 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package session
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// readUnixPacket reads a packet and the files passed along with it.
+func readUnixPacket(conn *net.UnixConn, b []byte) (int, []*os.File, error) {
+	oob := make([]byte, syscall.CmsgSpace(UnixMaxFiles*4))
+	n, oobn, flags, _, err := conn.ReadMsgUnix(b, oob)
+	if err != nil || oobn == 0 {
+		return n, nil, err
+	}
+
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return n, nil, err
+	}
+
+	var files []*os.File
+	for i := range msgs {
+		fds, err := syscall.ParseUnixRights(&msgs[i])
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			files = append(files, os.NewFile(uintptr(fd), "unix-passed"))
+		}
+	}
+
+	if flags&syscall.MSG_CTRUNC != 0 {
+		// some files had been discarded by system.
+		closeFiles(files)
+		return n, nil, ErrTooManyFiles
+	}
+
+	return n, files, nil
+}
+
+// writeUnixPacket writes a packet along with the descriptors of files.
+func writeUnixPacket(conn *net.UnixConn, b []byte, files []*os.File) error {
+	if len(files) > UnixMaxFiles {
+		return ErrTooManyFiles
+	}
+
+	fds := make([]int, len(files))
+	for i, f := range files {
+		fds[i] = int(f.Fd())
+	}
+
+	_, _, err := conn.WriteMsgUnix(b, syscall.UnixRights(fds...), nil)
+	return err
+}
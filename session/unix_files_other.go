@@ -0,0 +1,18 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package session
+
+import (
+	"net"
+	"os"
+)
+
+func readUnixPacket(conn *net.UnixConn, b []byte) (int, []*os.File, error) {
+	n, err := conn.Read(b)
+	return n, nil, err
+}
+
+func writeUnixPacket(conn *net.UnixConn, b []byte, files []*os.File) error {
+	return ErrFilesNotSupported
+}
@@ -0,0 +1,168 @@
+//go:build linux
+// +build linux
+
+package session
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fileMsg struct {
+	msg   []byte
+	files []*os.File
+}
+
+type unixFileCodecs struct {
+	tcpCodecs
+}
+
+func (c *unixFileCodecs) Encode(o interface{}) (Message, error) {
+	if msg, ok := o.(*fileMsg); ok {
+		return NewFileMessage(msg.msg, msg.files...), nil
+	}
+	return c.tcpCodecs.Encode(o)
+}
+
+func (c *unixFileCodecs) DecodeFiles(bytes []byte, files []*os.File) (interface{}, error) {
+	return &fileMsg{msg: bytes, files: files}, nil
+}
+
+func TestUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	addr := filepath.Join(dir, "stream.sock")
+	listener, err := ListenUnix("unix", addr)
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	var (
+		sendMsgCount  = int32(10)
+		clientReceive int32
+	)
+
+	go func() {
+		srvSession, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		srvSession.SetCodecs(&tcpCodecs{})
+		srvSession.Start(func(s Session, e Event) {
+			if e.Type() == EventType_Message {
+				s.Send(e.Message())
+			}
+		})
+	}()
+
+	cliSession, err := ConnectUnix("unix", addr)
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	if _, ok := cliSession.(*UnixSession); !ok {
+		t.Fatalf("session type %T", cliSession)
+	}
+	cliSession.SetCodecs(&tcpCodecs{})
+	cliSession.Start(func(s Session, e Event) {
+		if e.Type() == EventType_Message {
+			atomic.AddInt32(&clientReceive, 1)
+		}
+	})
+	defer cliSession.Close()
+
+	for i := int32(0); i < sendMsgCount; i++ {
+		cliSession.Send(&stringMsg{msg: make([]byte, 100)})
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&clientReceive) < sendMsgCount {
+		if time.Now().After(deadline) {
+			t.Fatalf("client receive %d", atomic.LoadInt32(&clientReceive))
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+}
+
+func TestUnixPacketFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	addr := filepath.Join(dir, "packet.sock")
+	listener, err := ListenUnix("unixpacket", addr)
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	received := make(chan *fileMsg, 1)
+	go func() {
+		srvSession, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		srvSession.SetCodecs(&unixFileCodecs{})
+		srvSession.Start(func(s Session, e Event) {
+			if e.Type() == EventType_Message {
+				if msg, ok := e.Message().(*fileMsg); ok {
+					received <- msg
+				}
+			}
+		})
+	}()
+
+	cliSession, err := ConnectUnix("unixpacket", addr)
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	if _, ok := cliSession.(*UnixPacketSession); !ok {
+		t.Fatalf("session type %T", cliSession)
+	}
+	cliSession.SetCodecs(&unixFileCodecs{})
+	cliSession.Start(func(s Session, e Event) {})
+	defer cliSession.Close()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if err := cliSession.Send(&fileMsg{msg: []byte("pipe"), files: []*os.File{w}}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case msg := <-received:
+		if string(msg.msg) != "pipe" || len(msg.files) != 1 {
+			t.Fatalf("receive msg %q with %d files", msg.msg, len(msg.files))
+		}
+		// write through the passed descriptor.
+		msg.files[0].Write([]byte("hello"))
+		msg.files[0].Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait message timeout")
+	}
+
+	buf := make([]byte, 5)
+	if _, err := r.Read(buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("read pipe %q, %v", buf, err)
+	}
+	// the file sent is closed by session.
+	r.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := r.Read(buf); err != io.EOF {
+		t.Fatalf("read pipe after closed, %v", err)
+	}
+}
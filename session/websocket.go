@@ -0,0 +1,790 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	goio "io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Godyy/go-net/io"
+)
+
+const (
+	WebSocketDefaultMaxMsgSize = 65536
+
+	// wsControlTimeout is the timeout of writing control frames.
+	wsControlTimeout = 1 * time.Second
+)
+
+// WebSocket close codes defined by RFC 6455.
+const (
+	WebSocketCloseNormal          = 1000
+	WebSocketCloseGoingAway       = 1001
+	WebSocketCloseProtocolError   = 1002
+	WebSocketCloseUnsupportedData = 1003
+	WebSocketCloseNoStatus        = 1005
+	WebSocketCloseAbnormal        = 1006
+	WebSocketCloseInvalidPayload  = 1007
+	WebSocketClosePolicyViolation = 1008
+	WebSocketCloseMessageTooBig   = 1009
+	WebSocketCloseInternalError   = 1011
+)
+
+// WebSocket frame opcodes.
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xa
+)
+
+const (
+	wsMaxHeaderLen      = 14
+	wsMaxControlPayload = 125
+	wsAcceptGUID        = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+// WebSocketSession is a session over WebSocket connection. Each message is
+// sent as a single binary frame, and each data message received, which
+// may be fragmented, is decoded once. The control frames are handled
+// internally.
+type WebSocketSession struct {
+	session
+	client    bool          // 客户端会话，发送的帧需要掩码
+	pending   []byte        // 握手时预读的数据
+	wsem      chan struct{} // 帧写入信号量
+	closeSent int32         // 是否已发送关闭帧
+	closeMtx  sync.Mutex
+	closeCode int    // 对端关闭码
+	closeText string // 对端关闭原因
+}
+
+func newWebSocketSession(conn net.Conn, client bool, pending []byte) *WebSocketSession {
+	s := &WebSocketSession{
+		client:  client,
+		pending: pending,
+		wsem:    make(chan struct{}, 1),
+	}
+	s.session = newSession(s, conn, WebSocketDefaultMaxMsgSize)
+	return s
+}
+
+// Close sends the normal close frame to peer, then close the session.
+func (ws *WebSocketSession) Close() error {
+	return ws.closeWith(WebSocketCloseNormal, "")
+}
+
+// CloseStatus returns the close code and text sent by peer. The code is zero
+// if peer had not closed the session.
+func (ws *WebSocketSession) CloseStatus() (code int, text string) {
+	ws.closeMtx.Lock()
+	defer ws.closeMtx.Unlock()
+	return ws.closeCode, ws.closeText
+}
+
+func (ws *WebSocketSession) closeWith(code int, text string) error {
+	if ws.isStarted(true) && !ws.isClosed(true) && atomic.CompareAndSwapInt32(&ws.closeSent, 0, 1) {
+		ws.writeControl(wsOpClose, wsClosePayload(code, text))
+	}
+	return ws.session.Close()
+}
+
+// closeWrite sends the normal close frame while closing gracefully, the
+// session is closed once peer replies.
+func (ws *WebSocketSession) closeWrite() {
+	if !atomic.CompareAndSwapInt32(&ws.closeSent, 0, 1) {
+		// closing handshake started by peer.
+		return
+	}
+	if ws.writeControl(wsOpClose, wsClosePayload(WebSocketCloseNormal, "")) != nil {
+		ws.closeWithEvent(CloseReason_LocalGracefulClose)
+	}
+}
+
+func (ws *WebSocketSession) setCloseStatus(code int, text string) {
+	ws.closeMtx.Lock()
+	ws.closeCode, ws.closeText = code, text
+	ws.closeMtx.Unlock()
+}
+
+// frame returns the header and payload of frame. The payload of client
+// is masked on a copy.
+func (ws *WebSocketSession) frame(op byte, payload []byte) ([]byte, []byte) {
+	if !ws.client {
+		return wsFrameHeader(op, len(payload), nil), payload
+	}
+
+	var key [4]byte
+	rand.Read(key[:])
+	masked := make([]byte, len(payload))
+	copy(masked, payload)
+	wsMask(masked, key, 0)
+	return wsFrameHeader(op, len(payload), key[:]), masked
+}
+
+// writeControl writes a control frame, it gives up if frames writing blocked
+// for a while.
+func (ws *WebSocketSession) writeControl(op byte, payload []byte) error {
+	timer := time.NewTimer(wsControlTimeout)
+	defer timer.Stop()
+
+	select {
+	case ws.wsem <- struct{}{}:
+		defer func() { <-ws.wsem }()
+	case <-timer.C:
+		return errTimeout
+	}
+
+	hdr, payload := ws.frame(op, payload)
+	bufs := net.Buffers{hdr, payload}
+	ws.conn.SetWriteDeadline(time.Now().Add(wsControlTimeout))
+	defer ws.conn.SetWriteDeadline(time.Time{})
+	_, err := bufs.WriteTo(ws.conn)
+	return err
+}
+
+// writeFrames writes the frames entirely, returns false if the session closed.
+func (ws *WebSocketSession) writeFrames(bufs net.Buffers) bool {
+	ws.wsem <- struct{}{}
+	defer func() { <-ws.wsem }()
+
+	for len(bufs) > 0 {
+		if ws.sendTimeout > 0 {
+			ws.conn.SetWriteDeadline(time.Now().Add(ws.sendTimeout))
+		}
+
+		n, err := bufs.WriteTo(ws.conn)
+		ws.count(counterBytesSent, int(n))
+		if err != nil {
+			// if session had been closed, directly return.
+			if ws.isClosed(true) {
+				return false
+			}
+
+			if isConnRST(err) {
+				ws.session.Close()
+				ws.notifyEvent(newEventClose(CloseReason_ConnReset))
+				return false
+			}
+
+			ws.countError(err)
+			ws.notifyEvent(newEventError(newError(ErrorType_SendMessage, err)))
+			if !isTimeout(err) {
+				time.Sleep(100 * time.Millisecond)
+			}
+		}
+	}
+	return true
+}
+
+func (ws *WebSocketSession) sendThread() {
+	for !ws.isClosed(true) {
+		var (
+			bufs    net.Buffers
+			msgs    []Message
+			size    int
+			closing = ws.isClosing(true)
+			waitPop = !closing
+		)
+
+		// collect frames until send buffer full.
+		for size < ws.sendBuffSize {
+			msg := ws.popMessage(waitPop)
+			if msg == nil {
+				break
+			}
+			waitPop = false
+
+			hdr, payload := ws.frame(wsOpBinary, msg.Data())
+			bufs = append(bufs, hdr, payload)
+			msgs = append(msgs, msg)
+			size += len(hdr) + len(payload)
+		}
+
+		if len(bufs) == 0 {
+			if closing && ws.sendPending() == 0 {
+				// all messages flushed, start the closing handshake.
+				ws.closeWrite()
+				return
+			}
+			continue
+		}
+
+		ok := ws.writeFrames(bufs)
+		for _, msg := range msgs {
+			if ok {
+				ws.sent(msg)
+			}
+			msg.Release()
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+func (ws *WebSocketSession) receiveThread() {
+	var (
+		receiveBuffer = io.NewBinaryBuffer(maxInt(ws.receiveBuffSize, wsMaxHeaderLen))
+		reader        goio.Reader
+		frame         wsFrame
+		inFrame       bool       // 正在读取帧载荷
+		maskPos       int        // 载荷掩码位置
+		msgBytes      = []byte{} // 数据消息
+		msgStarted    bool       // 正在读取分片的数据消息
+		discard       bool       // 丢弃超长的数据消息
+		control       []byte     // 控制帧载荷
+	)
+
+	if len(ws.pending) > 0 {
+		reader = goio.MultiReader(bytes.NewReader(ws.pending), ws.conn)
+		ws.pending = nil
+	} else {
+		reader = ws.conn
+	}
+	reader = countReader{r: reader, s: &ws.session}
+
+	for !ws.isClosed(true) {
+		receiveBuffer.Trim()
+
+		/* 接收字节流数据 */
+		if ws.receiveTimeout > 0 {
+			ws.conn.SetReadDeadline(time.Now().Add(ws.receiveTimeout))
+		}
+
+		if n, err := receiveBuffer.ReadFrom(reader); n == 0 || err != nil {
+			// if session had been closed, directly return.
+			if ws.isClosed(true) {
+				return
+			}
+
+			ws.countError(err)
+			switch {
+			case n == 0 || isEOF(err):
+				// remote close connection without close frame.
+				ws.setCloseStatus(WebSocketCloseAbnormal, "")
+				ws.closeWithEvent(CloseReason_RemoteClose)
+				return
+
+			case isConnRST(err):
+				ws.setCloseStatus(WebSocketCloseAbnormal, "")
+				ws.session.Close()
+				ws.notifyEvent(newEventClose(CloseReason_ConnReset))
+				return
+
+			default:
+				ws.notifyEvent(newEventError(newError(ErrorType_ReceiveMessage, err)))
+				if !isTimeout(err) {
+					time.Sleep(100 * time.Millisecond)
+				}
+				continue
+			}
+		}
+
+		for receiveBuffer.Buffered() > 0 {
+			if !inFrame {
+				hdr, _ := receiveBuffer.Peek(receiveBuffer.Buffered())
+				f, n, err := parseWsFrameHeader(hdr)
+				if err == nil && n > 0 {
+					err = ws.checkFrame(f, msgStarted)
+				}
+				if err != nil {
+					ws.fail(WebSocketCloseProtocolError, err)
+					return
+				}
+				if n == 0 {
+					// header incomplete.
+					break
+				}
+				receiveBuffer.Discard(n)
+
+				frame, inFrame, maskPos = f, true, 0
+				if f.isControl() {
+					control = control[:0]
+				} else if !discard && int64(len(msgBytes))+f.length > int64(ws.maxMsgSize) {
+					// receive a size-exceed message, notify event and discard it's data.
+					ws.count(counterOversized, 1)
+					ws.notifyEvent(newEventError(newError(ErrorType_ReceiveMessage, ErrMsgTooLarge)))
+					discard = true
+					msgBytes = msgBytes[:0]
+				}
+			}
+
+			// extract payload.
+			k := int64(receiveBuffer.Buffered())
+			if k > frame.length {
+				k = frame.length
+			}
+			chunk, _ := receiveBuffer.Peek(int(k))
+			if frame.masked {
+				maskPos = wsMask(chunk, frame.key, maskPos)
+			}
+			if frame.isControl() {
+				control = append(control, chunk...)
+			} else if !discard {
+				msgBytes = append(msgBytes, chunk...)
+			}
+			receiveBuffer.Discard(int(k))
+			frame.length -= k
+			if frame.length > 0 {
+				// partial extract, continue receive data.
+				break
+			}
+			inFrame = false
+
+			if frame.isControl() {
+				if !ws.handleControl(frame.op, control) {
+					return
+				}
+				continue
+			}
+
+			msgStarted = !frame.fin
+			if !frame.fin {
+				continue
+			}
+
+			if discard {
+				discard = false
+			} else if msg, err := ws.codecs.Decode(msgBytes); err != nil {
+				ws.count(counterDecodeErrors, 1)
+				ws.notifyEvent(newEventError(newError(ErrorType_ReceiveMessage, err)))
+			} else {
+				ws.count(counterMessagesReceived, 1)
+				ws.notifyEvent(newEventMessage(msg))
+			}
+			msgBytes = msgBytes[:0]
+		}
+	}
+}
+
+// checkFrame validates the frame header received.
+func (ws *WebSocketSession) checkFrame(f wsFrame, msgStarted bool) error {
+	switch {
+	case f.masked == ws.client:
+		// frames from client must be masked, and frames from server must not.
+		return ErrWebSocketProtocol
+	case f.isControl():
+		if !f.fin || f.length > wsMaxControlPayload {
+			return ErrWebSocketProtocol
+		}
+		switch f.op {
+		case wsOpClose, wsOpPing, wsOpPong:
+		default:
+			return ErrWebSocketProtocol
+		}
+	case f.op == wsOpContinuation:
+		if !msgStarted {
+			return ErrWebSocketProtocol
+		}
+	case f.op == wsOpText || f.op == wsOpBinary:
+		if msgStarted {
+			return ErrWebSocketProtocol
+		}
+	default:
+		return ErrWebSocketProtocol
+	}
+	return nil
+}
+
+// handleControl handles the control frame, returns false if session closed.
+func (ws *WebSocketSession) handleControl(op byte, payload []byte) bool {
+	switch op {
+	case wsOpPing:
+		ws.writeControl(wsOpPong, payload)
+
+	case wsOpClose:
+		code, text := WebSocketCloseNoStatus, ""
+		if len(payload) == 1 {
+			ws.fail(WebSocketCloseProtocolError, ErrWebSocketProtocol)
+			return false
+		} else if len(payload) >= 2 {
+			code, text = int(binary.BigEndian.Uint16(payload)), string(payload[2:])
+		}
+		ws.setCloseStatus(code, text)
+
+		if !atomic.CompareAndSwapInt32(&ws.closeSent, 0, 1) {
+			// reply of the close frame sent by local, session is closing.
+			if ws.isClosing(true) {
+				ws.closeWithEvent(CloseReason_LocalGracefulClose)
+			}
+			return false
+		}
+
+		// echo the close frame.
+		if code == WebSocketCloseNoStatus {
+			ws.writeControl(wsOpClose, nil)
+		} else {
+			ws.writeControl(wsOpClose, wsClosePayload(code, ""))
+		}
+
+		ws.closeWithEvent(fmt.Sprintf("%s, code %d %s", CloseReason_RemoteClose, code, text))
+		return false
+	}
+	return true
+}
+
+// fail closes the session because of protocol error.
+func (ws *WebSocketSession) fail(code int, err error) {
+	if ws.isClosed(true) {
+		return
+	}
+	ws.notifyEvent(newEventError(newError(ErrorType_ReceiveMessage, err)))
+	ws.closeWith(code, err.Error())
+	ws.notifyEvent(newEventClose(CloseReason_ProtocolError))
+}
+
+type wsFrame struct {
+	fin    bool
+	op     byte
+	masked bool
+	key    [4]byte
+	length int64
+}
+
+func (f *wsFrame) isControl() bool { return f.op&0x8 != 0 }
+
+// parseWsFrameHeader parses frame header, n is zero if header incomplete.
+func parseWsFrameHeader(b []byte) (f wsFrame, n int, err error) {
+	if len(b) < 2 {
+		return
+	}
+
+	if b[0]&0x70 != 0 {
+		// reserved bits must be zero without extensions.
+		return f, 0, ErrWebSocketProtocol
+	}
+	f.fin = b[0]&0x80 != 0
+	f.op = b[0] & 0x0f
+	f.masked = b[1]&0x80 != 0
+
+	n = 2
+	switch length := b[1] & 0x7f; length {
+	case 126:
+		if len(b) < n+2 {
+			return f, 0, nil
+		}
+		f.length = int64(binary.BigEndian.Uint16(b[n:]))
+		n += 2
+	case 127:
+		if len(b) < n+8 {
+			return f, 0, nil
+		}
+		l := binary.BigEndian.Uint64(b[n:])
+		if l>>63 != 0 {
+			return f, 0, ErrWebSocketProtocol
+		}
+		f.length = int64(l)
+		n += 8
+	default:
+		f.length = int64(length)
+	}
+
+	if f.masked {
+		if len(b) < n+4 {
+			return f, 0, nil
+		}
+		copy(f.key[:], b[n:])
+		n += 4
+	}
+	return f, n, nil
+}
+
+func wsFrameHeader(op byte, length int, key []byte) []byte {
+	var (
+		hdr  = make([]byte, 0, wsMaxHeaderLen)
+		mask byte
+	)
+	if key != nil {
+		mask = 0x80
+	}
+
+	hdr = append(hdr, 0x80|op)
+	switch {
+	case length < 126:
+		hdr = append(hdr, mask|byte(length))
+	case length <= 0xffff:
+		hdr = append(hdr, mask|126, byte(length>>8), byte(length))
+	default:
+		hdr = append(hdr, mask|127)
+		hdr = append(hdr, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(hdr[2:], uint64(length))
+	}
+	return append(hdr, key...)
+}
+
+// wsMask masks or unmasks the bytes, starting from pos of key, returns the
+// next pos.
+func wsMask(b []byte, key [4]byte, pos int) int {
+	for i := range b {
+		b[i] ^= key[pos&3]
+		pos++
+	}
+	return pos & 3
+}
+
+func wsClosePayload(code int, text string) []byte {
+	if len(text) > wsMaxControlPayload-2 {
+		text = text[:wsMaxControlPayload-2]
+	}
+	payload := make([]byte, 2+len(text))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	copy(payload[2:], text)
+	return payload
+}
+
+func wsAcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key))
+	h.Write([]byte(wsAcceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// wsHeaderContains reports whether the comma-separated header contains the
+// token, case-insensitively.
+func wsHeaderContains(h http.Header, name, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// WebSocketListener is a HTTP server upgrading the requests to the path to
+// WebSocket sessions.
+type WebSocketListener struct {
+	stats     listenerStats // 会话统计
+	l         net.Listener
+	srv       *http.Server
+	acceptCh  chan *WebSocketSession
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *WebSocketListener) Accept() (Session, error) {
+	return l.AcceptWebSocket()
+}
+
+func (l *WebSocketListener) AcceptWebSocket() (*WebSocketSession, error) {
+	select {
+	case s := <-l.acceptCh:
+		l.stats.accept(s)
+		return s, nil
+	case <-l.closed:
+		return nil, ErrListenerClosed
+	}
+}
+
+// Close stops the HTTP server, the sessions accepted are not affected.
+func (l *WebSocketListener) Close() error {
+	err := ErrListenerClosed
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		err = l.srv.Close()
+	})
+	return err
+}
+
+func (l *WebSocketListener) Network() string {
+	return l.l.Addr().Network()
+}
+
+func (l *WebSocketListener) Addr() string {
+	return l.l.Addr().String()
+}
+
+func (l *WebSocketListener) Stats() ListenerStats {
+	return l.stats.load()
+}
+
+// ServeHTTP performs the opening handshake of WebSocket.
+func (l *WebSocketListener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet ||
+		!wsHeaderContains(r.Header, "Connection", "upgrade") ||
+		!wsHeaderContains(r.Header, "Upgrade", "websocket") ||
+		key == "" {
+		http.Error(w, "bad websocket handshake", http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + wsAcceptKey(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return
+	}
+
+	var pending []byte
+	if n := rw.Reader.Buffered(); n > 0 {
+		pending, _ = rw.Reader.Peek(n)
+		pending = append([]byte(nil), pending...)
+	}
+
+	select {
+	case l.acceptCh <- newWebSocketSession(conn, false, pending):
+	case <-l.closed:
+		conn.Close()
+	}
+}
+
+// ListenWebSocket listens on the TCP address and serves the WebSocket
+// handshake on the path.
+func ListenWebSocket(network, addr, path string) (*WebSocketListener, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		ln, err := net.Listen(network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		l := &WebSocketListener{
+			l:        ln,
+			acceptCh: make(chan *WebSocketSession),
+			closed:   make(chan struct{}),
+		}
+		mux := http.NewServeMux()
+		mux.Handle(path, l)
+		l.srv = &http.Server{Handler: mux}
+		go l.srv.Serve(ln)
+		return l, nil
+
+	default:
+		return nil, ErrUnknownNetwork
+	}
+}
+
+func ConnectWebSocket(rawurl string) (*WebSocketSession, error) {
+	return ConnectWebSocketTimeout(rawurl, 0)
+}
+
+// ConnectWebSocketTimeout connects to the "ws" or "wss" URL and performs the
+// opening handshake, the timeout covers both.
+func ConnectWebSocketTimeout(rawurl string, timeout time.Duration) (*WebSocketSession, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		dialer = &net.Dialer{Timeout: timeout}
+		host   = u.Host
+		conn   net.Conn
+	)
+	switch u.Scheme {
+	case "ws":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+		conn, err = dialer.Dial("tcp", host)
+	case "wss":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, ErrUnknownNetwork
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+	pending, err := wsClientHandshake(conn, u)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	return newWebSocketSession(conn, true, pending), nil
+}
+
+// wsClientHandshake performs the client opening handshake, returns the data
+// received after the response.
+func wsClientHandshake(conn net.Conn, u *url.URL) ([]byte, error) {
+	var nonce [16]byte
+	rand.Read(nonce[:])
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+
+	request := "GET " + u.RequestURI() + " HTTP/1.1\r\n" +
+		"Host: " + u.Host + "\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + key + "\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := conn.Write([]byte(request)); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		!wsHeaderContains(resp.Header, "Connection", "upgrade") ||
+		!wsHeaderContains(resp.Header, "Upgrade", "websocket") ||
+		resp.Header.Get("Sec-WebSocket-Accept") != wsAcceptKey(key) {
+		return nil, ErrWebSocketHandshake
+	}
+
+	var pending []byte
+	if n := br.Buffered(); n > 0 {
+		pending, _ = br.Peek(n)
+		pending = append([]byte(nil), pending...)
+	}
+	return pending, nil
+}
@@ -0,0 +1,203 @@
+package session
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebSocket(t *testing.T) {
+	listener, err := ListenWebSocket("tcp4", "127.0.0.1:0", "/ws")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	var (
+		sizes         = []int{0, 100, 1000, 70000}
+		clientReceive int32
+		srvReason     = make(chan string, 1)
+		srvSession    *WebSocketSession
+		accepted      = make(chan struct{})
+	)
+
+	go func() {
+		s, err := listener.AcceptWebSocket()
+		if err != nil {
+			return
+		}
+		srvSession = s
+		srvSession.SetCodecs(&tcpCodecs{})
+		srvSession.SetMaxMessage(100000)
+		srvSession.Start(func(s Session, e Event) {
+			switch e.Type() {
+			case EventType_Message:
+				s.Send(e.Message())
+			case EventType_Close:
+				srvReason <- e.Reason()
+			}
+		})
+		close(accepted)
+	}()
+
+	cliSession, err := ConnectWebSocketTimeout("ws://"+listener.Addr()+"/ws", time.Second)
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	cliSession.SetCodecs(&tcpCodecs{})
+	cliSession.SetMaxMessage(100000)
+	cliSession.Start(func(s Session, e Event) {
+		if e.Type() == EventType_Message {
+			if n := len(e.Message().(*stringMsg).msg); n != sizes[atomic.LoadInt32(&clientReceive)] {
+				t.Errorf("receive msg len %d", n)
+			}
+			atomic.AddInt32(&clientReceive, 1)
+		}
+	})
+
+	for _, size := range sizes {
+		cliSession.Send(&stringMsg{msg: make([]byte, size)})
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&clientReceive) < int32(len(sizes)) {
+		if time.Now().After(deadline) {
+			t.Fatalf("client receive %d", atomic.LoadInt32(&clientReceive))
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	cliSession.Close()
+	<-accepted
+	select {
+	case r := <-srvReason:
+		if code, _ := srvSession.CloseStatus(); code != WebSocketCloseNormal || !strings.HasPrefix(r, CloseReason_RemoteClose) {
+			t.Fatalf("close reason %q, code %d", r, code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait close timeout")
+	}
+}
+
+func TestWebSocketFrames(t *testing.T) {
+	listener, err := ListenWebSocket("tcp4", "127.0.0.1:0", "/")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		srvSession, err := listener.AcceptWebSocket()
+		if err != nil {
+			return
+		}
+		srvSession.SetCodecs(&tcpCodecs{})
+		srvSession.Start(func(s Session, e Event) {
+			if e.Type() == EventType_Message {
+				received <- string(e.Message().(*stringMsg).msg)
+			}
+		})
+	}()
+
+	conn, err := net.Dial("tcp4", listener.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := wsClientHandshake(conn, &url.URL{Scheme: "ws", Host: listener.Addr(), Path: "/"}); err != nil {
+		t.Fatalf("handshake failed, %s", err)
+	}
+
+	writeFrame := func(fin bool, op byte, payload string) {
+		key := [4]byte{1, 2, 3, 4}
+		hdr := wsFrameHeader(op, len(payload), key[:])
+		if !fin {
+			hdr[0] &^= 0x80
+		}
+		data := []byte(payload)
+		wsMask(data, key, 0)
+		conn.Write(append(hdr, data...))
+	}
+
+	// fragmented message with a ping interleaved.
+	writeFrame(false, wsOpText, "hel")
+	writeFrame(true, wsOpPing, "p")
+	writeFrame(true, wsOpContinuation, "lo")
+
+	pong := make([]byte, 3)
+	if _, err := conn.Read(pong); err != nil || pong[0] != 0x80|wsOpPong || pong[1] != 1 || pong[2] != 'p' {
+		t.Fatalf("read pong %v, %v", pong, err)
+	}
+
+	select {
+	case msg := <-received:
+		if msg != "hello" {
+			t.Fatalf("receive msg %q", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait message timeout")
+	}
+}
+
+func TestWebSocketCloseGracefully(t *testing.T) {
+	listener, err := ListenWebSocket("tcp4", "127.0.0.1:0", "/ws")
+	if err != nil {
+		t.Fatalf("create listener failed, %s", err)
+	}
+	defer listener.Close()
+
+	var (
+		sendMsgCount  = 100
+		serverReceive int32
+		srvReason     = make(chan string, 1)
+	)
+	go func() {
+		srvSession, err := listener.AcceptWebSocket()
+		if err != nil {
+			return
+		}
+		srvSession.SetCodecs(&tcpCodecs{})
+		srvSession.Start(func(s Session, e Event) {
+			switch e.Type() {
+			case EventType_Message:
+				atomic.AddInt32(&serverReceive, 1)
+			case EventType_Close:
+				srvReason <- e.Reason()
+			}
+		})
+	}()
+
+	cliSession, err := ConnectWebSocketTimeout("ws://"+listener.Addr()+"/ws", time.Second)
+	if err != nil {
+		t.Fatalf("connect server failed, %s", err)
+	}
+	cliReason := make(chan string, 1)
+	cliSession.SetCodecs(&tcpCodecs{})
+	cliSession.SetSendQueue(sendMsgCount)
+	cliSession.Start(func(s Session, e Event) {
+		if e.Type() == EventType_Close {
+			cliReason <- e.Reason()
+		}
+	})
+
+	for i := 0; i < sendMsgCount; i++ {
+		cliSession.Send(&stringMsg{msg: make([]byte, 1000)})
+	}
+	if err := cliSession.CloseGracefully(5 * time.Second); err != nil {
+		t.Fatalf("close gracefully failed, %s", err)
+	}
+	if n := atomic.LoadInt32(&serverReceive); n != int32(sendMsgCount) {
+		t.Fatalf("server receive %d", n)
+	}
+	if r := <-cliReason; r != CloseReason_LocalGracefulClose {
+		t.Fatalf("client close reason %q", r)
+	}
+	if r := <-srvReason; !strings.HasPrefix(r, CloseReason_RemoteClose) {
+		t.Fatalf("server close reason %q", r)
+	}
+}